@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vbehar/daggerverse/artifactory/internal/dagger"
+)
+
+const (
+	// temporary directory of the JFrog CLI, where the build-info is collected before being published
+	jfrogTempDir = "/tmp/jfrog-cli"
+	// directory where the JFrog CLI stores the build-info
+	buildInfoDir = jfrogTempDir + "/jfrog/builds"
+)
+
+// Build is a build-info, collected locally until it is published to Artifactory.
+// Use it to trace the published artifacts back to the build and the git commit which produced them.
+type Build struct {
+	// +private
+	Artifactory *Artifactory
+	// name of the build.
+	Name string
+	// number of the build.
+	Number string
+	// +private
+	State *dagger.Directory
+}
+
+// Build starts a new build-info with the given name and number.
+// The artifacts published through the build are recorded in its build-info,
+// which is sent to Artifactory with Publish.
+func (a *Artifactory) Build(
+	// name of the build.
+	name string,
+	// number of the build - such as the CI pipeline ID.
+	number string,
+) *Build {
+	return &Build{
+		Artifactory: a,
+		Name:        name,
+		Number:      number,
+		State:       dag.Directory(),
+	}
+}
+
+// PublishFile publishes a single file to artifactory, and records it as a build artifact.
+func (b *Build) PublishFile(
+	ctx context.Context,
+	// file to publish.
+	file *dagger.File,
+	// target path in artifactory.
+	destination string,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) (*Build, error) {
+	return b.withResult(ctx, b.Artifactory.publishFile(file, destination, b, logLevel))
+}
+
+// PublishGoLib publishes a Go library to the given repository,
+// and records it as a build artifact - with its dependencies.
+func (b *Build) PublishGoLib(
+	ctx context.Context,
+	// directory containing the Go library to publish.
+	src *dagger.Directory,
+	// version of the library to publish.
+	// Default to the "git" version (from the `git describe` cmd).
+	// +optional
+	version string,
+	// name of the repository to publish to.
+	repo string,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) (*Build, error) {
+	return b.withResult(ctx, b.Artifactory.publishGoLib(ctx, src, version, repo, b, logLevel))
+}
+
+// CollectEnv records the environment variables in the build-info.
+// The environment of a Dagger container is minimal, so the variables to record must be given.
+// Variables matching *password*, *secret*, *key*, *token*... are excluded when publishing.
+func (b *Build) CollectEnv(
+	ctx context.Context,
+	// environment variables to record.
+	// format: KEY=VALUE
+	env []string,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) (*Build, error) {
+	ctr := dag.Container().From(baseWolfiImage).
+		With(b.withState())
+	for _, e := range env {
+		key, value, ok := strings.Cut(e, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid environment variable %q: expected KEY=VALUE", e)
+		}
+		ctr = ctr.WithEnvVariable(key, value)
+	}
+
+	return b.withResult(ctx, b.Artifactory.Command(
+		[]string{"rt", "build-collect-env", b.Name, b.Number},
+		ctr,
+		logLevel))
+}
+
+// CollectGit records the git information of the given repository in the build-info:
+// revision, branch, remote URL and commit message.
+func (b *Build) CollectGit(
+	ctx context.Context,
+	// directory containing the git repository - including its .git subdirectory.
+	gitDirectory *dagger.Directory,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) (*Build, error) {
+	return b.withResult(ctx, b.Artifactory.Command(
+		[]string{"rt", "build-add-git", b.Name, b.Number, "/git"},
+		dag.Container().From(baseWolfiImage).
+			WithExec([]string{"apk", "add", "--no-cache", "git"}).
+			WithMountedDirectory("/git", gitDirectory).
+			WithExec([]string{"git", "config", "--global", "--add", "safe.directory", "/git"}).
+			With(b.withState()),
+		logLevel))
+}
+
+// Publish publishes the build-info to Artifactory.
+// Returns the URL of the build-info in the Artifactory UI.
+func (b *Build) Publish(
+	ctx context.Context,
+	// URL of the CI build, recorded in the build-info.
+	// +optional
+	buildURL string,
+	// patterns of the environment variables to publish.
+	// +optional
+	envInclude []string,
+	// patterns of the environment variables to exclude.
+	// Default to *password*;*psw*;*secret*;*key*;*token*;*auth*.
+	// +optional
+	envExclude []string,
+	// do not publish the build-info, just log it - and return an empty URL.
+	// +optional
+	dryRun bool,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) (string, error) {
+	cmd := []string{
+		"rt", "build-publish",
+		b.Name, b.Number,
+		"--dry-run=" + strconv.FormatBool(dryRun),
+	}
+	if buildURL != "" {
+		cmd = append(cmd, "--build-url="+buildURL)
+	}
+	if len(envInclude) > 0 {
+		cmd = append(cmd, "--env-include="+strings.Join(envInclude, ";"))
+	}
+	if len(envExclude) > 0 {
+		cmd = append(cmd, "--env-exclude="+strings.Join(envExclude, ";"))
+	}
+
+	output, err := b.Artifactory.Command(
+		cmd,
+		dag.Container().From(baseWolfiImage).
+			With(withoutCache()).
+			With(b.withState()),
+		logLevel).
+		Stdout(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish build %s/%s: %w", b.Name, b.Number, err)
+	}
+	if dryRun {
+		return "", nil
+	}
+
+	var result struct {
+		BuildInfoUiUrl string `json:"buildInfoUiUrl"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return "", fmt.Errorf("failed to parse build publish output: %w", err)
+	}
+	return result.BuildInfoUiUrl, nil
+}
+
+// Promote promotes the published build to another repository:
+// its artifacts - and optionally its dependencies - are moved or copied to the target repository.
+func (b *Build) Promote(
+	ctx context.Context,
+	// repository to promote the build to.
+	targetRepo string,
+	// promotion status to record, such as "staged" or "released".
+	// +optional
+	status string,
+	// promotion comment to record.
+	// +optional
+	comment string,
+	// only promote the artifacts stored in this repository.
+	// +optional
+	sourceRepo string,
+	// also promote the build dependencies.
+	// +optional
+	includeDependencies bool,
+	// copy the artifacts to the target repository, instead of moving them.
+	// +optional
+	copyArtifacts bool,
+	// properties to set on the promoted artifacts.
+	// format: key=value
+	// +optional
+	props []string,
+	// do not promote the build, just simulate the promotion.
+	// +optional
+	dryRun bool,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) error {
+	cmd := []string{
+		"rt", "build-promote",
+		b.Name, b.Number, targetRepo,
+		"--include-dependencies=" + strconv.FormatBool(includeDependencies),
+		"--copy=" + strconv.FormatBool(copyArtifacts),
+		"--dry-run=" + strconv.FormatBool(dryRun),
+	}
+	if status != "" {
+		cmd = append(cmd, "--status="+status)
+	}
+	if comment != "" {
+		cmd = append(cmd, "--comment="+comment)
+	}
+	if sourceRepo != "" {
+		cmd = append(cmd, "--source-repo="+sourceRepo)
+	}
+	if len(props) > 0 {
+		cmd = append(cmd, "--props="+strings.Join(props, ";"))
+	}
+
+	_, err := b.Artifactory.Command(
+		cmd,
+		dag.Container().From(baseWolfiImage).With(withoutCache()),
+		logLevel).
+		Sync(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to promote build %s/%s to %s: %w", b.Name, b.Number, targetRepo, err)
+	}
+	return nil
+}
+
+// Discard discards the old builds with the same name from Artifactory,
+// keeping only the most recent ones.
+func (b *Build) Discard(
+	ctx context.Context,
+	// maximum number of days to keep the builds.
+	// +optional
+	maxDays int,
+	// maximum number of builds to keep.
+	// +optional
+	maxBuilds int,
+	// build numbers to keep.
+	// +optional
+	excludeBuilds []string,
+	// also delete the artifacts of the discarded builds.
+	// +optional
+	deleteArtifacts bool,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) error {
+	if maxDays <= 0 && maxBuilds <= 0 {
+		return fmt.Errorf("either max days or max builds is required")
+	}
+
+	cmd := []string{
+		"rt", "build-discard",
+		b.Name,
+		"--delete-artifacts=" + strconv.FormatBool(deleteArtifacts),
+	}
+	if maxDays > 0 {
+		cmd = append(cmd, "--max-days="+strconv.Itoa(maxDays))
+	}
+	if maxBuilds > 0 {
+		cmd = append(cmd, "--max-builds="+strconv.Itoa(maxBuilds))
+	}
+	if len(excludeBuilds) > 0 {
+		cmd = append(cmd, "--exclude-builds="+strings.Join(excludeBuilds, ","))
+	}
+
+	_, err := b.Artifactory.Command(
+		cmd,
+		dag.Container().From(baseWolfiImage).With(withoutCache()),
+		logLevel).
+		Sync(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to discard builds %s: %w", b.Name, err)
+	}
+	return nil
+}
+
+// flags returns the flags recording a jf command in the build-info.
+func (b *Build) flags() []string {
+	return []string{
+		"--build-name=" + b.Name,
+		"--build-number=" + b.Number,
+	}
+}
+
+// withState makes the build-info collected so far available to the JFrog CLI.
+func (b *Build) withState() dagger.WithContainerFunc {
+	return func(ctr *dagger.Container) *dagger.Container {
+		return ctr.
+			WithEnvVariable("JFROG_CLI_TEMP_DIR", jfrogTempDir).
+			WithDirectory(buildInfoDir, b.State)
+	}
+}
+
+// withResult runs the given container, and returns a new build with the build-info it collected.
+func (b *Build) withResult(ctx context.Context, ctr *dagger.Container) (*Build, error) {
+	ctr, err := ctr.Sync(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record build %s/%s: %w", b.Name, b.Number, err)
+	}
+
+	build := *b
+	build.State = ctr.Directory(buildInfoDir)
+	return &build, nil
+}
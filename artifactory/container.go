@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/vbehar/daggerverse/artifactory/internal/dagger"
+)
+
+const (
+	// path of the file describing the pushed image, for the build-info
+	imageFilePath = "/tmp/jfrog/image-file"
+)
+
+// PublishContainer pushes a container to an Artifactory Docker/OCI repository,
+// using the credentials of the Artifactory instance.
+// The registry is the host of the Artifactory instance - using the repository path method -
+// unless another registry is given.
+// Returns the reference of the pushed image, with its digest.
+func (a *Artifactory) PublishContainer(
+	ctx context.Context,
+	// container to publish.
+	container *dagger.Container,
+	// image to publish to, starting with the name of the Docker repository.
+	// format: <repository>/<name>:<tag>
+	// example: docker-local/my-app:v1.2.3
+	image string,
+	// containers of the other platforms, to publish a multi-platform image.
+	// +optional
+	platformVariants []*dagger.Container,
+	// registry host, if it is not the host of the Artifactory instance.
+	// +optional
+	registry string,
+) (string, error) {
+	if registry == "" {
+		instanceURL, err := url.Parse(a.InstanceURL)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse instance URL %q: %w", a.InstanceURL, err)
+		}
+		registry = instanceURL.Host
+	}
+	if registry == "" {
+		return "", fmt.Errorf("no registry host in instance URL %q: use an absolute URL, or set the registry", a.InstanceURL)
+	}
+
+	if a.Username != "" && a.Password != nil {
+		container = container.WithRegistryAuth(registry, a.Username, a.Password)
+	}
+
+	ref, err := container.Publish(ctx, registry+"/"+image, dagger.ContainerPublishOpts{
+		PlatformVariants: platformVariants,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to publish container to %s/%s: %w", registry, image, err)
+	}
+	return ref, nil
+}
+
+// PublishContainer pushes a container to an Artifactory Docker/OCI repository,
+// and records it as a build artifact.
+// See Artifactory.PublishContainer.
+func (b *Build) PublishContainer(
+	ctx context.Context,
+	// container to publish.
+	container *dagger.Container,
+	// image to publish to, starting with the name of the Docker repository.
+	// format: <repository>/<name>:<tag>
+	// example: docker-local/my-app:v1.2.3
+	image string,
+	// containers of the other platforms, to publish a multi-platform image.
+	// +optional
+	platformVariants []*dagger.Container,
+	// registry host, if it is not the host of the Artifactory instance.
+	// +optional
+	registry string,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) (*Build, error) {
+	ref, err := b.Artifactory.PublishContainer(ctx, container, image, platformVariants, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, _, _ := strings.Cut(image, "/")
+	cmd := append([]string{
+		"rt", "build-docker-create",
+		repo,
+		"--image-file=" + imageFilePath,
+	}, b.flags()...)
+
+	return b.withResult(ctx, b.Artifactory.Command(
+		cmd,
+		dag.Container().From(baseWolfiImage).
+			// the image file holds a single line: <image>:<tag>@sha256:<digest>
+			WithNewFile(imageFilePath, ref+"\n").
+			With(b.withState()),
+		logLevel))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/vbehar/daggerverse/artifactory/internal/dagger"
+)
+
+const (
+	// directory where the artifacts are downloaded
+	downloadDir = "/downloads"
+)
+
+// Download downloads the artifacts matching the given path or wildcard pattern,
+// and returns them as a directory.
+// By default, the artifacts keep their hierarchy in the repository.
+func (a *Artifactory) Download(
+	// path or wildcard pattern of the artifacts to download, starting with the repository name.
+	// example: generic-local/tools/*.tar.gz
+	pattern string,
+	// download all the artifacts at the root of the directory, instead of preserving their hierarchy.
+	// +optional
+	flat bool,
+	// also download the artifacts matching the pattern in sub-directories.
+	// +optional
+	// +default=true
+	recursive bool,
+	// patterns of the artifacts to exclude.
+	// +optional
+	exclusions []string,
+	// only download the artifacts with these properties.
+	// format: key=value
+	// +optional
+	props []string,
+	// verify the checksums of the downloaded artifacts against the checksums stored in Artifactory.
+	// +optional
+	// +default=true
+	verifyChecksum bool,
+	// extract the downloaded archives (tar, tar.gz, zip, ...).
+	// +optional
+	explode bool,
+	// fail if no artifact matches the pattern.
+	// +optional
+	// +default=true
+	failNoOp bool,
+	// reuse the result of a previous download with the same arguments, instead of downloading the artifacts again.
+	// Only for artifacts which never change, such as released versions.
+	// +optional
+	cache bool,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) *dagger.Directory {
+	cmd := []string{
+		"rt", "dl",
+		pattern,
+		downloadDir + "/",
+		"--flat=" + strconv.FormatBool(flat),
+		"--recursive=" + strconv.FormatBool(recursive),
+		"--skip-checksum=" + strconv.FormatBool(!verifyChecksum),
+		"--explode=" + strconv.FormatBool(explode),
+		"--fail-no-op=" + strconv.FormatBool(failNoOp),
+	}
+	if len(exclusions) > 0 {
+		cmd = append(cmd, "--exclusions="+strings.Join(exclusions, ";"))
+	}
+	if len(props) > 0 {
+		cmd = append(cmd, "--props="+strings.Join(props, ";"))
+	}
+
+	ctr := dag.Container().From(baseWolfiImage).
+		WithDirectory(downloadDir, dag.Directory())
+	if !cache {
+		ctr = ctr.With(withoutCache())
+	}
+
+	return a.Command(cmd, ctr, logLevel).
+		Directory(downloadDir)
+}
+
+// DownloadFile downloads a single artifact, and returns it as a file.
+func (a *Artifactory) DownloadFile(
+	// path of the artifact to download, starting with the repository name - without wildcards.
+	// example: generic-local/tools/tool-v1.2.3.tar.gz
+	path string,
+	// expected SHA-256 checksum of the artifact. If set, the download fails if the checksum does not match,
+	// and the result of a previous download of the same artifact is reused.
+	// +optional
+	sha256 string,
+	// verify the checksum of the downloaded artifact against the checksum stored in Artifactory.
+	// +optional
+	// +default=true
+	verifyChecksum bool,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) *dagger.File {
+	file := a.Download(path, true, false, nil, nil, verifyChecksum, false, true, sha256 != "", logLevel).
+		File(path[strings.LastIndex(path, "/")+1:])
+	if sha256 == "" {
+		return file
+	}
+
+	return dag.Container().From(baseWolfiImage).
+		WithFile("/tmp/artifact", file).
+		WithEnvVariable("EXPECTED_SHA256", sha256).
+		WithExec([]string{
+			"/bin/sh", "-c",
+			"echo \"${EXPECTED_SHA256}  /tmp/artifact\" | sha256sum -c -",
+		}).
+		File("/tmp/artifact")
+}
@@ -63,3 +63,56 @@ func (e *Examples) Artifactory_PublishGoLib(
 		},
 	)
 }
+
+func (e *Examples) Artifactory_Download(
+	instanceName string,
+	artifactoryUser string,
+	artifactoryPassword *dagger.Secret,
+	// +optional
+	// +default="debug"
+	logLevel string,
+) *dagger.Directory {
+	instanceURL := "https://artifactory." + instanceName + ".org/artifactory"
+
+	return dag.Artifactory(instanceURL, dagger.ArtifactoryOpts{
+		InstanceName: instanceName,
+		Username:     artifactoryUser,
+		Password:     artifactoryPassword,
+	}).Download(
+		"some-repo/some/path/*.go",
+		dagger.ArtifactoryDownloadOpts{
+			Flat:     true,
+			LogLevel: logLevel,
+		},
+	)
+}
+
+func (e *Examples) Artifactory_BuildInfo(
+	ctx context.Context,
+	instanceName string,
+	artifactoryUser string,
+	artifactoryPassword *dagger.Secret,
+	// +optional
+	// +default="debug"
+	logLevel string,
+) (string, error) {
+	instanceURL := "https://artifactory." + instanceName + ".org/artifactory"
+
+	return dag.Artifactory(instanceURL, dagger.ArtifactoryOpts{
+		InstanceName: instanceName,
+		Username:     artifactoryUser,
+		Password:     artifactoryPassword,
+	}).
+		Build("my-build", "42").
+		PublishFile(
+			dag.CurrentModule().Source().Directory("testdata").File("main.go"),
+			"some-repo/some/path/main.go",
+			dagger.ArtifactoryBuildPublishFileOpts{
+				LogLevel: logLevel,
+			},
+		).
+		CollectEnv([]string{"CI_PIPELINE_ID=42"}).
+		Publish(ctx, dagger.ArtifactoryBuildPublishOpts{
+			LogLevel: logLevel,
+		})
+}
@@ -6,6 +6,7 @@ package main
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/vbehar/daggerverse/artifactory/internal/dagger"
 )
@@ -134,16 +135,7 @@ func (a *Artifactory) PublishFile(
 	// +optional
 	logLevel string,
 ) (string, error) {
-	return a.Command(
-		[]string{
-			"rt", "u",
-			"/src",
-			destination,
-		},
-		dag.Container().From(baseWolfiImage).
-			WithMountedFile("/src", file),
-		logLevel).
-		Stdout(ctx)
+	return a.publishFile(file, destination, nil, logLevel).Stdout(ctx)
 }
 
 // PublishGoLib publishes a Go library to the given repository.
@@ -161,6 +153,28 @@ func (a *Artifactory) PublishGoLib(
 	// +optional
 	logLevel string,
 ) *dagger.Container {
+	return a.publishGoLib(ctx, src, version, repo, nil, logLevel)
+}
+
+// publishFile returns a container uploading a file, optionally recorded in the given build-info.
+func (a *Artifactory) publishFile(file *dagger.File, destination string, build *Build, logLevel string) *dagger.Container {
+	cmd := []string{
+		"rt", "u",
+		"/src",
+		destination,
+	}
+	ctr := dag.Container().From(baseWolfiImage).
+		WithMountedFile("/src", file)
+	if build != nil {
+		cmd = append(cmd, build.flags()...)
+		ctr = ctr.With(build.withState())
+	}
+
+	return a.Command(cmd, ctr, logLevel)
+}
+
+// publishGoLib returns a container publishing a Go library, optionally recorded in the given build-info.
+func (a *Artifactory) publishGoLib(ctx context.Context, src *dagger.Directory, version, repo string, build *Build, logLevel string) *dagger.Container {
 	if version == "" {
 		var err error
 		version, err = dag.GitInfo(src).Version(ctx)
@@ -169,7 +183,19 @@ func (a *Artifactory) PublishGoLib(
 		}
 		version = strings.TrimSpace(version)
 	}
-	return dag.Container().From(baseGoImage).
+
+	publishCmd := []string{
+		"go-publish",
+		"--detailed-summary",
+		version,
+	}
+	ctr := dag.Container().From(baseGoImage)
+	if build != nil {
+		publishCmd = append(publishCmd, build.flags()...)
+		ctr = ctr.With(build.withState())
+	}
+
+	return ctr.
 		WithMountedDirectory("/src", src).
 		WithWorkdir("/src").
 		WithEnvVariable("GOWORK", "off"). // jf tries to run `go list -mod=mod -m` which won't work in workspace mode
@@ -178,11 +204,7 @@ func (a *Artifactory) PublishGoLib(
 			"--repo-deploy=" + repo,
 			"--server-id-deploy=" + a.InstanceName,
 		}, "")).
-		With(jfCommand(a, []string{
-			"go-publish",
-			"--detailed-summary",
-			version,
-		}, logLevel)).
+		With(jfCommand(a, publishCmd, logLevel)).
 		WithoutEnvVariable("GOWORK")
 }
 
@@ -204,6 +226,14 @@ func jfLogLevel(
 	}
 }
 
+// withoutCache makes sure that the next exec is not cached by Dagger,
+// for the commands reading or modifying the current state of Artifactory.
+func withoutCache() dagger.WithContainerFunc {
+	return func(ctr *dagger.Container) *dagger.Container {
+		return ctr.WithEnvVariable("ARTIFACTORY_NO_CACHE", time.Now().Format(time.RFC3339Nano))
+	}
+}
+
 func jfCommand(
 	a *Artifactory,
 	cmd []string,
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// path of the JFrog file spec used for AQL searches
+	searchSpecPath = "/tmp/jfrog/search-spec.json"
+)
+
+// Artifact is an artifact stored in Artifactory.
+type Artifact struct {
+	// path of the artifact, starting with the repository name.
+	Path string
+	// type of the artifact: file or folder.
+	Type string
+	// size of the artifact, in bytes.
+	Size int
+	// creation time of the artifact.
+	Created string
+	// last modification time of the artifact.
+	Modified string
+	// SHA-1 checksum of the artifact.
+	Sha1 string
+	// SHA-256 checksum of the artifact.
+	Sha256 string
+	// MD5 checksum of the artifact.
+	Md5 string
+	// properties of the artifact.
+	Properties []*Property
+}
+
+// Property is a property of an artifact. A property can have multiple values.
+type Property struct {
+	// name of the property.
+	Key string
+	// values of the property.
+	Values []string
+}
+
+// Property returns the first value of the given property, or an empty string if the artifact does not have it.
+func (a *Artifact) Property(
+	// name of the property.
+	key string,
+) string {
+	for _, prop := range a.Properties {
+		if prop.Key == key && len(prop.Values) > 0 {
+			return prop.Values[0]
+		}
+	}
+	return ""
+}
+
+// SetProps sets properties on the artifacts matching the given path or wildcard pattern.
+// Returns the number of artifacts updated.
+func (a *Artifactory) SetProps(
+	ctx context.Context,
+	// path or wildcard pattern of the artifacts, starting with the repository name.
+	// example: generic-local/my-app/v1.2.3/*
+	pattern string,
+	// properties to set.
+	// format: key=value
+	props []string,
+	// also update the artifacts matching the pattern in sub-directories.
+	// +optional
+	// +default=true
+	recursive bool,
+	// patterns of the artifacts to exclude.
+	// +optional
+	exclusions []string,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) (int, error) {
+	if len(props) == 0 {
+		return 0, fmt.Errorf("at least one property is required")
+	}
+
+	cmd := []string{
+		"rt", "sp",
+		pattern,
+		strings.Join(props, ";"),
+		"--recursive=" + strconv.FormatBool(recursive),
+	}
+	if len(exclusions) > 0 {
+		cmd = append(cmd, "--exclusions="+strings.Join(exclusions, ";"))
+	}
+
+	output, err := a.Command(cmd, dag.Container().From(baseWolfiImage).With(withoutCache()), logLevel).Stdout(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set properties: %w", err)
+	}
+	return commandSuccessCount(output)
+}
+
+// DeleteProps deletes properties from the artifacts matching the given path or wildcard pattern.
+// Returns the number of artifacts updated.
+func (a *Artifactory) DeleteProps(
+	ctx context.Context,
+	// path or wildcard pattern of the artifacts, starting with the repository name.
+	// example: generic-local/my-app/v1.2.3/*
+	pattern string,
+	// names of the properties to delete.
+	keys []string,
+	// also update the artifacts matching the pattern in sub-directories.
+	// +optional
+	// +default=true
+	recursive bool,
+	// patterns of the artifacts to exclude.
+	// +optional
+	exclusions []string,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) (int, error) {
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("at least one property key is required")
+	}
+
+	cmd := []string{
+		"rt", "delp",
+		pattern,
+		strings.Join(keys, ","),
+		"--recursive=" + strconv.FormatBool(recursive),
+	}
+	if len(exclusions) > 0 {
+		cmd = append(cmd, "--exclusions="+strings.Join(exclusions, ";"))
+	}
+
+	output, err := a.Command(cmd, dag.Container().From(baseWolfiImage).With(withoutCache()), logLevel).Stdout(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete properties: %w", err)
+	}
+	return commandSuccessCount(output)
+}
+
+// Search searches artifacts, either by path or wildcard pattern and properties,
+// or with an AQL query.
+func (a *Artifactory) Search(
+	ctx context.Context,
+	// path or wildcard pattern of the artifacts, starting with the repository name.
+	// example: generic-local/my-app/*
+	// +optional
+	pattern string,
+	// only return the artifacts with these properties.
+	// format: key=value
+	// +optional
+	props []string,
+	// do not return the artifacts with these properties.
+	// format: key=value
+	// +optional
+	excludeProps []string,
+	// AQL criteria of the items.find query, instead of a pattern.
+	// example: {"repo": "generic-local", "@git.commit": "abc1234"}
+	// See https://jfrog.com/help/r/jfrog-rest-apis/artifactory-query-language
+	// +optional
+	aql string,
+	// also search the artifacts matching the pattern in sub-directories.
+	// +optional
+	// +default=true
+	recursive bool,
+	// fields to sort the results by, such as created or name.
+	// +optional
+	sortBy []string,
+	// sort order: asc or desc.
+	// +optional
+	// +default="asc"
+	sortOrder string,
+	// maximum number of results. 0 for no limit.
+	// +optional
+	limit int,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) ([]*Artifact, error) {
+	var (
+		cmd = []string{"rt", "s"}
+		ctr = dag.Container().From(baseWolfiImage).With(withoutCache())
+	)
+	switch {
+	case pattern != "" && aql != "":
+		return nil, fmt.Errorf("cannot search with both a pattern and an AQL query")
+	case aql != "":
+		if !json.Valid([]byte(aql)) {
+			return nil, fmt.Errorf("invalid AQL criteria: not a JSON object: %s", aql)
+		}
+		spec := `{"files": [{"aql": {"items.find": ` + aql + `}}]}`
+		ctr = ctr.WithNewFile(searchSpecPath, spec)
+		cmd = append(cmd, "--spec="+searchSpecPath)
+	case pattern != "":
+		cmd = append(cmd, pattern, "--recursive="+strconv.FormatBool(recursive))
+		if len(props) > 0 {
+			cmd = append(cmd, "--props="+strings.Join(props, ";"))
+		}
+		if len(excludeProps) > 0 {
+			cmd = append(cmd, "--exclude-props="+strings.Join(excludeProps, ";"))
+		}
+	default:
+		return nil, fmt.Errorf("either a pattern or an AQL query is required")
+	}
+	if len(sortBy) > 0 {
+		cmd = append(cmd, "--sort-by="+strings.Join(sortBy, ";"), "--sort-order="+sortOrder)
+	}
+	if limit > 0 {
+		cmd = append(cmd, "--limit="+strconv.Itoa(limit))
+	}
+
+	output, err := a.Command(cmd, ctr, logLevel).Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search artifacts: %w", err)
+	}
+
+	var results []struct {
+		Path     string              `json:"path"`
+		Type     string              `json:"type"`
+		Size     int                 `json:"size"`
+		Created  string              `json:"created"`
+		Modified string              `json:"modified"`
+		Sha1     string              `json:"sha1"`
+		Sha256   string              `json:"sha256"`
+		Md5      string              `json:"md5"`
+		Props    map[string][]string `json:"props"`
+	}
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		return nil, fmt.Errorf("failed to parse search results: %w", err)
+	}
+
+	artifacts := make([]*Artifact, 0, len(results))
+	for _, result := range results {
+		artifact := &Artifact{
+			Path:     result.Path,
+			Type:     result.Type,
+			Size:     result.Size,
+			Created:  result.Created,
+			Modified: result.Modified,
+			Sha1:     result.Sha1,
+			Sha256:   result.Sha256,
+			Md5:      result.Md5,
+		}
+		for key, values := range result.Props {
+			artifact.Properties = append(artifact.Properties, &Property{
+				Key:    key,
+				Values: values,
+			})
+		}
+		slices.SortFunc(artifact.Properties, func(a, b *Property) int {
+			return strings.Compare(a.Key, b.Key)
+		})
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts, nil
+}
+
+// commandSuccessCount parses the summary printed by the jf commands,
+// and returns the number of successful operations - or an error if some failed.
+func commandSuccessCount(output string) (int, error) {
+	var summary struct {
+		Status string `json:"status"`
+		Totals struct {
+			Success int `json:"success"`
+			Failure int `json:"failure"`
+		} `json:"totals"`
+	}
+	if err := json.Unmarshal([]byte(output), &summary); err != nil {
+		return 0, fmt.Errorf("failed to parse command summary: %w", err)
+	}
+	if summary.Totals.Failure > 0 {
+		return summary.Totals.Success, fmt.Errorf("%d operations failed, %d succeeded", summary.Totals.Failure, summary.Totals.Success)
+	}
+	return summary.Totals.Success, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vbehar/daggerverse/artifactory/internal/dagger"
+)
+
+const (
+	// directory where the files to upload are mounted
+	uploadDir = "/src"
+	// path of the JFrog file spec used for the upload
+	uploadSpecPath = "/tmp/jfrog/upload-spec.json"
+)
+
+// UploadSummary is the summary of an upload to Artifactory.
+type UploadSummary struct {
+	// status of the upload: success or failure.
+	Status string
+	// number of files successfully uploaded.
+	Succeeded int
+	// number of files which failed to upload.
+	Failed int
+	// uploaded files.
+	Files []*UploadedFile
+}
+
+// UploadedFile is a file uploaded to Artifactory.
+type UploadedFile struct {
+	// path of the file in the uploaded directory.
+	Source string
+	// URL of the artifact in Artifactory.
+	Target string
+	// path of the artifact in Artifactory, starting with the repository name.
+	Path string
+	// size of the file, in bytes.
+	Size int
+	// SHA-256 checksum of the file.
+	Sha256 string
+}
+
+// uploadSpec is a JFrog file spec for uploads.
+// See https://docs.jfrog-applications.jfrog.io/jfrog-applications/jfrog-cli/cli-for-jfrog-artifactory/using-file-specs
+type uploadSpec struct {
+	Files []uploadSpecFile `json:"files"`
+}
+
+type uploadSpecFile struct {
+	Pattern     string   `json:"pattern"`
+	Target      string   `json:"target"`
+	TargetProps string   `json:"targetProps,omitempty"`
+	Exclusions  []string `json:"exclusions,omitempty"`
+	Recursive   string   `json:"recursive"`
+	Flat        string   `json:"flat"`
+}
+
+// PublishDirectory publishes the files of a directory to artifactory,
+// and returns a summary of the uploaded files.
+// The files to upload are selected with include/exclude patterns,
+// or with a JFrog file spec - whose patterns are relative to the directory.
+func (a *Artifactory) PublishDirectory(
+	ctx context.Context,
+	// directory containing the files to publish.
+	src *dagger.Directory,
+	// target path in artifactory, starting with the repository name.
+	// The files are uploaded under this path.
+	// Ignored when using a file spec.
+	// +optional
+	destination string,
+	// wildcard patterns of the files to publish, relative to the directory.
+	// Default to all the files.
+	// +optional
+	include []string,
+	// wildcard patterns of the files to exclude, relative to the directory.
+	// +optional
+	exclude []string,
+	// upload all the files at the root of the target path, instead of preserving their hierarchy.
+	// +optional
+	flat bool,
+	// properties to set on all the uploaded files.
+	// format: key=value
+	// +optional
+	props []string,
+	// properties to set on the files matching a pattern, in addition to the common properties.
+	// The first matching pattern wins, and its files are uploaded even if they do not match the include patterns.
+	// format: pattern:key=value[;key=value...]
+	// example: *.tar.gz:type=archive;os=linux
+	// +optional
+	fileProps []string,
+	// JFrog file spec describing the files to upload.
+	// If set, the include/exclude patterns, flat and properties options are ignored.
+	// See https://docs.jfrog-applications.jfrog.io/jfrog-applications/jfrog-cli/cli-for-jfrog-artifactory/using-file-specs
+	// +optional
+	spec *dagger.File,
+	// variables to replace in the file spec.
+	// format: key=value
+	// +optional
+	specVars []string,
+	// do not upload anything, just report what would be uploaded.
+	// +optional
+	dryRun bool,
+	// log level to use for the command. If empty, the default log level will be used.
+	// +optional
+	logLevel string,
+) (*UploadSummary, error) {
+	if spec == nil {
+		if destination == "" {
+			return nil, fmt.Errorf("a destination or a file spec is required")
+		}
+		specJSON, err := newUploadSpec(destination, include, exclude, flat, props, fileProps)
+		if err != nil {
+			return nil, err
+		}
+		spec = dag.Directory().WithNewFile("upload-spec.json", specJSON).File("upload-spec.json")
+	}
+
+	cmd := []string{
+		"rt", "u",
+		"--spec=" + uploadSpecPath,
+		"--detailed-summary",
+		"--dry-run=" + strconv.FormatBool(dryRun),
+	}
+	if len(specVars) > 0 {
+		cmd = append(cmd, "--spec-vars="+strings.Join(specVars, ";"))
+	}
+
+	output, err := a.Command(
+		cmd,
+		dag.Container().From(baseWolfiImage).
+			WithMountedDirectory(uploadDir, src).
+			WithMountedFile(uploadSpecPath, spec).
+			WithWorkdir(uploadDir),
+		logLevel).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload directory: %w", err)
+	}
+
+	return a.uploadSummary(ctx, output, src)
+}
+
+// newUploadSpec returns the JSON file spec uploading the files of the directory to the destination.
+// Each pattern with specific properties has its own entry, excluded from the entries of the previous patterns,
+// so that each file is uploaded only once.
+func newUploadSpec(destination string, include, exclude []string, flat bool, props, fileProps []string) (string, error) {
+	if !strings.HasSuffix(destination, "/") {
+		destination += "/"
+	}
+	if len(include) == 0 {
+		include = []string{"*"}
+	}
+
+	var (
+		spec       uploadSpec
+		exclusions = exclude
+	)
+	for _, fileProp := range fileProps {
+		pattern, patternProps, ok := strings.Cut(fileProp, ":")
+		if !ok || pattern == "" || patternProps == "" {
+			return "", fmt.Errorf("invalid file properties %q: expected pattern:key=value[;key=value...]", fileProp)
+		}
+		spec.Files = append(spec.Files, uploadSpecFile{
+			Pattern:     pattern,
+			Target:      destination,
+			TargetProps: strings.Join(slices.Concat(props, []string{patternProps}), ";"),
+			Exclusions:  exclusions,
+			Recursive:   "true",
+			Flat:        strconv.FormatBool(flat),
+		})
+		exclusions = slices.Concat(exclusions, []string{pattern})
+	}
+	for _, pattern := range include {
+		spec.Files = append(spec.Files, uploadSpecFile{
+			Pattern:     pattern,
+			Target:      destination,
+			TargetProps: strings.Join(props, ";"),
+			Exclusions:  exclusions,
+			Recursive:   "true",
+			Flat:        strconv.FormatBool(flat),
+		})
+	}
+
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal upload spec: %w", err)
+	}
+	return string(data), nil
+}
+
+// uploadSummary parses the detailed summary of an upload,
+// and completes it with the size of the uploaded files.
+func (a *Artifactory) uploadSummary(ctx context.Context, output string, src *dagger.Directory) (*UploadSummary, error) {
+	var result struct {
+		Status string `json:"status"`
+		Totals struct {
+			Success int `json:"success"`
+			Failure int `json:"failure"`
+		} `json:"totals"`
+		Files []struct {
+			Source string `json:"source"`
+			Target string `json:"target"`
+			Sha256 string `json:"sha256"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse upload summary: %w", err)
+	}
+
+	summary := &UploadSummary{
+		Status:    result.Status,
+		Succeeded: result.Totals.Success,
+		Failed:    result.Totals.Failure,
+	}
+	for _, file := range result.Files {
+		source := strings.TrimPrefix(strings.TrimPrefix(file.Source, uploadDir+"/"), "./")
+		size, err := src.File(source).Size(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get size of %s: %w", source, err)
+		}
+		summary.Files = append(summary.Files, &UploadedFile{
+			Source: source,
+			Target: file.Target,
+			Path:   strings.TrimPrefix(file.Target, strings.TrimSuffix(a.InstanceURL, "/")+"/"),
+			Size:   size,
+			Sha256: file.Sha256,
+		})
+	}
+	return summary, nil
+}
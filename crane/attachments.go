@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+const (
+	// org.opencontainers.image.title is used by ORAS and others to name the layers of an artifact
+	annotationTitle = "org.opencontainers.image.title"
+
+	attachmentKindSignature   = "signature"
+	attachmentKindAttestation = "attestation"
+	attachmentKindSBOM        = "sbom"
+	attachmentKindOther       = "other"
+)
+
+// Attachment is an artifact attached to an image,
+// such as a signature, an attestation or an SBOM.
+type Attachment struct {
+	// +private
+	Crane *Crane
+	// kind of the attachment: signature, attestation, sbom or other
+	Kind string
+	// image the attachment is attached to
+	Subject string
+	// reference of the attachment manifest
+	Reference string
+	// digest of the attachment manifest
+	Digest string
+	// media type of the attachment manifest
+	MediaType string
+	// artifact type of the attachment - for OCI referrers
+	ArtifactType string
+	// annotations of the attachment manifest
+	Annotations []*KeyValue
+	// layers of the attachment, holding its content
+	Layers []*Descriptor
+}
+
+// Directory returns the content of the attachment, as a directory with one file per layer.
+// Files are named after the org.opencontainers.image.title annotation of the layer,
+// or after the layer digest.
+func (a *Attachment) Directory(
+	ctx context.Context,
+	// +optional
+	ctr *dagger.Container,
+) (*dagger.Directory, error) {
+	repository := repositoryOf(a.Reference)
+	dir := dag.Directory()
+	for _, layer := range a.Layers {
+		name := valueOf(layer.Annotations, annotationTitle)
+		if name == "" {
+			name = strings.ReplaceAll(layer.Digest, ":", "-")
+		}
+		blob, err := a.Crane.blob(ctx, repository, layer.Digest, ctr)
+		if err != nil {
+			return nil, err
+		}
+		dir = dir.WithFile(name, blob)
+	}
+	return dir, nil
+}
+
+// Attachments discovers the artifacts attached to an image:
+// signatures, attestations and SBOMs, using the cosign tag convention
+// (<repository>:sha256-<digest>.sig, .att and .sbom)
+// and the OCI referrers API - or the referrers tag schema (<repository>:sha256-<digest>)
+// for the registries which do not support the API.
+// Note that credential helpers are not used to query the referrers API.
+// For a multi-platform image, the attachments of the index are returned.
+func (c *Crane) Attachments(
+	ctx context.Context,
+	// image to discover the attachments of
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// only return the attachments of these kinds: signature, attestation, sbom or other
+	// default to all kinds
+	// +optional
+	kinds []string,
+	// +optional
+	ctr *dagger.Container,
+) ([]*Attachment, error) {
+	cr := c.WithPlatform("")
+
+	ref, err := parseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	digest := ref.Digest
+	if digest == "" {
+		if digest, err = cr.Digest(ctx, image, "", ctr); err != nil {
+			return nil, err
+		}
+	}
+	tagPrefix := strings.Replace(digest, ":", "-", 1)
+
+	var attachments []*Attachment
+
+	// cosign tag convention
+	for suffix, kind := range map[string]string{
+		".sig":  attachmentKindSignature,
+		".att":  attachmentKindAttestation,
+		".sbom": attachmentKindSBOM,
+	} {
+		if len(kinds) > 0 && !slices.Contains(kinds, kind) {
+			continue
+		}
+
+		attachment, err := cr.attachment(ctx, image, ref.Repository+":"+tagPrefix+suffix, kind, ctr)
+		if err != nil {
+			return nil, err
+		}
+		if attachment != nil {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	// OCI referrers API, with the referrers tag schema as fallback
+	referrers, ok, err := cr.referrers(ctx, ref.Repository, digest)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		referrersTag := ref.Repository + ":" + tagPrefix
+		check, err := cr.checkImage(ctx, referrersTag, ctr)
+		if err != nil {
+			return nil, err
+		}
+		if check.Exists {
+			index, err := cr.Manifest(ctx, referrersTag, "", ctr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get referrers of %s: %w", image, err)
+			}
+			referrers = index.Manifests
+		}
+	}
+	for _, desc := range referrers {
+		kind := attachmentKind(desc.ArtifactType)
+		if len(kinds) > 0 && !slices.Contains(kinds, kind) {
+			continue
+		}
+
+		attachment, err := cr.attachment(ctx, image, ref.Repository+"@"+desc.Digest, kind, ctr)
+		if err != nil {
+			return nil, err
+		}
+		if attachment != nil {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	slices.SortFunc(attachments, func(a, b *Attachment) int {
+		return strings.Compare(a.Kind+a.Reference, b.Kind+b.Reference)
+	})
+	return attachments, nil
+}
+
+// attachment returns the attachment stored at the given reference,
+// or nil if it does not exist.
+func (c *Crane) attachment(ctx context.Context, subject, reference, kind string, ctr *dagger.Container) (*Attachment, error) {
+	check, err := c.checkImage(ctx, reference, ctr)
+	if err != nil {
+		return nil, err
+	}
+	if !check.Exists {
+		return nil, nil
+	}
+
+	manifest, err := c.Manifest(ctx, reference, "", ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest of attachment %s: %w", reference, err)
+	}
+
+	artifactType := manifest.ArtifactType
+	if artifactType == "" && manifest.Config != nil {
+		// artifacts created before OCI 1.1 use the config media type as artifact type
+		artifactType = manifest.Config.MediaType
+	}
+	if kind == "" {
+		kind = attachmentKind(artifactType)
+	}
+
+	return &Attachment{
+		Crane:        c,
+		Kind:         kind,
+		Subject:      subject,
+		Reference:    reference,
+		Digest:       manifest.Digest,
+		MediaType:    manifest.MediaType,
+		ArtifactType: artifactType,
+		Annotations:  manifest.Annotations,
+		Layers:       manifest.Layers,
+	}, nil
+}
+
+// attachmentKind guesses the kind of an attachment from its artifact type.
+func attachmentKind(artifactType string) string {
+	artifactType = strings.ToLower(artifactType)
+	switch {
+	case strings.Contains(artifactType, "spdx"),
+		strings.Contains(artifactType, "cyclonedx"),
+		strings.Contains(artifactType, "sbom"):
+		return attachmentKindSBOM
+	case strings.Contains(artifactType, "in-toto"),
+		strings.Contains(artifactType, "dsse"),
+		strings.Contains(artifactType, "attestation"),
+		strings.Contains(artifactType, "provenance"):
+		return attachmentKindAttestation
+	case strings.Contains(artifactType, "sig"),
+		strings.Contains(artifactType, "notary"):
+		return attachmentKindSignature
+	}
+	return attachmentKindOther
+}
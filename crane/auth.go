@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+const (
+	// directory of the Docker config.json used by crane
+	dockerConfigDir = "/tmp/crane/docker"
+)
+
+// RegistryAuth holds the credentials to authenticate to a registry.
+// Either a username and password, an identity token or a registry token is set.
+type RegistryAuth struct {
+	// registry to authenticate to
+	Registry string
+	// username to use for authentication with the registry
+	Username string
+	// password to use for authentication with the registry
+	Password *dagger.Secret
+	// identity token (OAuth2 refresh token) to exchange for a registry token
+	IdentityToken *dagger.Secret
+	// bearer token sent as-is to the registry
+	RegistryToken *dagger.Secret
+}
+
+// WithRegistryAuth returns a new Crane instance authenticated to an additional registry.
+// This is useful when a single command needs to interact with multiple registries,
+// such as copying an image from one registry to another.
+func (c *Crane) WithRegistryAuth(
+	// registry to authenticate to
+	registry string,
+	// username to use for authentication with the registry
+	username string,
+	// password to use for authentication with the registry
+	password *dagger.Secret,
+) *Crane {
+	cr := c.clone()
+	cr.RegistryAuths = append(cr.RegistryAuths, &RegistryAuth{
+		Registry: registry,
+		Username: username,
+		Password: password,
+	})
+	return cr
+}
+
+// WithRegistryToken returns a new Crane instance authenticated to an additional registry with a token.
+// By default the token is an identity token (OAuth2 refresh token), exchanged for a registry token.
+// Use bearer to send the token as-is to the registry.
+func (c *Crane) WithRegistryToken(
+	// registry to authenticate to
+	registry string,
+	// token to use for authentication with the registry
+	token *dagger.Secret,
+	// send the token as-is to the registry, as a bearer token
+	// +optional
+	// +default=false
+	bearer bool,
+) *Crane {
+	auth := &RegistryAuth{
+		Registry: registry,
+	}
+	if bearer {
+		auth.RegistryToken = token
+	} else {
+		auth.IdentityToken = token
+	}
+
+	cr := c.clone()
+	cr.RegistryAuths = append(cr.RegistryAuths, auth)
+	return cr
+}
+
+// WithDockerConfig returns a new Crane instance using an existing Docker config.json
+// as a base for the registries authentication.
+// The credentials configured with Login, WithRegistryAuth or WithRegistryToken are added to it.
+// Note that credential helpers (credHelpers, credsStore) are only usable
+// if their binaries are installed in the container.
+func (c *Crane) WithDockerConfig(
+	// Docker config.json
+	config *dagger.Secret,
+) *Crane {
+	cr := c.clone()
+	cr.BaseDockerConfig = config
+	return cr
+}
+
+// DockerConfig returns the Docker config.json used by crane, as a secret,
+// with the credentials of all the configured registries.
+// Use it to share the same credentials with other containers of the pipeline.
+func (c *Crane) DockerConfig(ctx context.Context) (*dagger.Secret, error) {
+	contents, err := c.dockerConfigFile().Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate docker config: %w", err)
+	}
+
+	// the name must be unique for a given content
+	sum := sha256.Sum256([]byte(contents))
+	return dag.SetSecret("crane-docker-config-"+hex.EncodeToString(sum[:8]), contents), nil
+}
+
+// SetDockerConfigOnContainer mounts the Docker config.json used by crane on the given container,
+// and sets the DOCKER_CONFIG environment variable accordingly.
+func (c *Crane) SetDockerConfigOnContainer(
+	ctx context.Context,
+	ctr *dagger.Container,
+	// directory where the config.json file is mounted
+	// +optional
+	// +default="/root/.docker"
+	dir string,
+) (*dagger.Container, error) {
+	config, err := c.DockerConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctr.
+		WithEnvVariable("DOCKER_CONFIG", dir).
+		WithMountedSecret(strings.TrimSuffix(dir, "/")+"/config.json", config), nil
+}
+
+// registryAuths returns all the registries credentials, including the main registry.
+func (c *Crane) registryAuths() []*RegistryAuth {
+	var auths []*RegistryAuth
+	if c.Registry != "" && c.Username != "" && c.Password != nil {
+		auths = append(auths, &RegistryAuth{
+			Registry: c.Registry,
+			Username: c.Username,
+			Password: c.Password,
+		})
+	}
+	return append(auths, c.RegistryAuths...)
+}
+
+func (c *Crane) hasAuth() bool {
+	return c.BaseDockerConfig != nil || len(c.registryAuths()) > 0
+}
+
+// dockerConfigFile generates the Docker config.json used by crane,
+// by merging the credentials of all the registries into the base config - if any.
+func (c *Crane) dockerConfigFile() *dagger.File {
+	ctr := dag.Container().From(baseWolfiImage).
+		WithExec([]string{"apk", "add", "--no-cache", "jq"})
+
+	if c.BaseDockerConfig != nil {
+		ctr = ctr.WithMountedSecret("/tmp/docker/base.json", c.BaseDockerConfig)
+	} else {
+		ctr = ctr.WithNewFile("/tmp/docker/base.json", "{}")
+	}
+
+	// secrets are given to jq as environment variables,
+	// so that they never appear in the command line
+	filter := ".auths = (.auths // {})"
+	for i, auth := range c.registryAuths() {
+		n := strconv.Itoa(i)
+		ctr = ctr.WithEnvVariable("REGISTRY_"+n, dockerConfigKey(auth.Registry))
+		switch {
+		case auth.RegistryToken != nil:
+			ctr = ctr.WithSecretVariable("REGISTRY_TOKEN_"+n, auth.RegistryToken)
+			filter += " | .auths[env.REGISTRY_" + n + "] = {registrytoken: env.REGISTRY_TOKEN_" + n + "}"
+		case auth.IdentityToken != nil:
+			ctr = ctr.WithSecretVariable("REGISTRY_TOKEN_"+n, auth.IdentityToken)
+			filter += " | .auths[env.REGISTRY_" + n + "] = {identitytoken: env.REGISTRY_TOKEN_" + n + "}"
+		default:
+			ctr = ctr.
+				WithEnvVariable("REGISTRY_USERNAME_"+n, auth.Username).
+				WithSecretVariable("REGISTRY_PASSWORD_"+n, auth.Password)
+			filter += " | .auths[env.REGISTRY_" + n + "] = {auth: (env.REGISTRY_USERNAME_" + n + " + \":\" + env.REGISTRY_PASSWORD_" + n + " | @base64)}"
+		}
+	}
+
+	return ctr.
+		WithExec([]string{"jq", filter, "/tmp/docker/base.json"}, dagger.ContainerWithExecOpts{
+			RedirectStdout: "/tmp/docker/config.json",
+		}).
+		File("/tmp/docker/config.json")
+}
+
+// dockerConfigKey returns the key of the registry in the auths section of a Docker config.json.
+// Docker Hub uses a legacy URL instead of its hostname.
+func dockerConfigKey(registry string) string {
+	switch registry {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return "https://index.docker.io/v1/"
+	}
+	return registry
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+	"golang.org/x/sync/errgroup"
+)
+
+// Inventory is the list of images stored in a registry.
+type Inventory struct {
+	// registry of the inventory
+	Registry string
+	// prefix of the repositories of the inventory - if any
+	Prefix string
+	// platform used to compute the size and creation time of multi-platform images
+	Platform string
+	// images of the inventory, one per tag
+	Images []*InventoryImage
+}
+
+// InventoryImage is a tagged image of an inventory.
+type InventoryImage struct {
+	// repository of the image
+	Repository string
+	// tag of the image
+	Tag string
+	// digest of the image - or of the index for multi-platform images
+	Digest string
+	// media type of the manifest
+	MediaType string
+	// platforms of a multi-platform image
+	Platforms []string
+	// total size of the image, in bytes
+	Size int
+	// creation time of the image, in RFC 3339 format
+	Created string
+	// error message - only for the images which could not be inspected,
+	// or the repositories whose tags could not be listed
+	Error string
+}
+
+// Json returns the JSON representation of the inventory.
+func (i *Inventory) Json() (string, error) { //nolint:stylecheck // we want to name it "json"
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal inventory: %w", err)
+	}
+	return string(data), nil
+}
+
+// JsonFile returns a dagger file containing the JSON representation of the inventory.
+func (i *Inventory) JsonFile() (*dagger.File, error) { //nolint:stylecheck // we want to name it "json-file"
+	data, err := i.Json()
+	if err != nil {
+		return nil, err
+	}
+	return dag.Directory().
+		WithNewFile("inventory.json", data).
+		File("inventory.json"), nil
+}
+
+// Csv returns the CSV representation of the inventory, with a header line.
+func (i *Inventory) Csv() (string, error) { //nolint:stylecheck // we want to name it "csv"
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	records := [][]string{
+		{"repository", "tag", "digest", "media_type", "platforms", "size", "created", "error"},
+	}
+	for _, image := range i.Images {
+		records = append(records, []string{
+			image.Repository,
+			image.Tag,
+			image.Digest,
+			image.MediaType,
+			strings.Join(image.Platforms, " "),
+			strconv.Itoa(image.Size),
+			image.Created,
+			image.Error,
+		})
+	}
+	if err := w.WriteAll(records); err != nil {
+		return "", fmt.Errorf("failed to write inventory as CSV: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// CsvFile returns a dagger file containing the CSV representation of the inventory.
+func (i *Inventory) CsvFile() (*dagger.File, error) { //nolint:stylecheck // we want to name it "csv-file"
+	data, err := i.Csv()
+	if err != nil {
+		return nil, err
+	}
+	return dag.Directory().
+		WithNewFile("inventory.csv", data).
+		File("inventory.csv"), nil
+}
+
+// Catalog lists the repositories of a registry.
+func (c *Crane) Catalog(
+	ctx context.Context,
+	// registry to list repositories from
+	// format: <host>[:<port>]
+	registry string,
+	// only return repositories starting with this prefix
+	// example: my-team/
+	// +optional
+	prefix string,
+	// print the full repository reference, including the registry
+	// +optional
+	// +default=false
+	fullRef bool,
+	// +optional
+	ctr *dagger.Container,
+) ([]string, error) {
+	output, err := c.Run(ctx, []string{"catalog", registry}, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run crane catalog: %w", err)
+	}
+
+	var repositories []string
+	for _, line := range strings.Split(output, "\n") {
+		repository := strings.TrimSpace(line)
+		if repository == "" || !strings.HasPrefix(repository, prefix) {
+			continue
+		}
+		if fullRef {
+			repository = registry + "/" + repository
+		}
+		repositories = append(repositories, repository)
+	}
+	return repositories, nil
+}
+
+// Inventory walks the repositories of a registry, and returns the list of their tagged images,
+// with their digest, size and creation time.
+// The images which could not be inspected are kept in the inventory, with their error,
+// as well as the repositories whose tags could not be listed - without a tag.
+// For multi-platform images, the size and creation time are the ones of the image for
+// the Crane platform - or linux/amd64 by default.
+func (c *Crane) Inventory(
+	ctx context.Context,
+	// registry to walk
+	// format: <host>[:<port>]
+	registry string,
+	// only walk repositories starting with this prefix
+	// example: my-team/
+	// +optional
+	prefix string,
+	// maximum number of images inspected concurrently
+	// +optional
+	// +default=8
+	concurrency int,
+	// +optional
+	ctr *dagger.Container,
+) (*Inventory, error) {
+	platform := c.Platform
+	if platform == "" {
+		platform = "linux/amd64"
+	}
+
+	repositories, err := c.Catalog(ctx, registry, prefix, true, ctr)
+	if err != nil {
+		return nil, err
+	}
+
+	var images, failed []*InventoryImage
+	for _, repository := range repositories {
+		tags, err := c.Ls(ctx, repository, false, true, ctr)
+		if err != nil {
+			// such as a repository the caller is not allowed to pull
+			failed = append(failed, &InventoryImage{
+				Repository: repository,
+				Error:      fmt.Sprintf("failed to list tags of %s: %s", repository, err),
+			})
+			continue
+		}
+		for _, tag := range tags {
+			images = append(images, &InventoryImage{
+				Repository: repository,
+				Tag:        tag,
+			})
+		}
+	}
+
+	var eg errgroup.Group
+	if concurrency > 0 {
+		eg.SetLimit(concurrency)
+	}
+	for _, image := range images {
+		eg.Go(func() error {
+			if err := c.inspectInventoryImage(ctx, image, platform, ctr); err != nil {
+				image.Error = err.Error()
+			}
+			return nil
+		})
+	}
+	_ = eg.Wait() // errors are reported in the result
+	images = append(images, failed...)
+
+	return &Inventory{
+		Registry: registry,
+		Prefix:   prefix,
+		Platform: platform,
+		Images:   images,
+	}, nil
+}
+
+// inspectInventoryImage fills the digest, size and creation time of an inventory image.
+func (c *Crane) inspectInventoryImage(ctx context.Context, image *InventoryImage, platform string, ctr *dagger.Container) error {
+	ref := image.Repository + ":" + image.Tag
+	cr := c.WithPlatform("")
+
+	manifest, err := cr.Manifest(ctx, ref, "", ctr)
+	if err != nil {
+		return fmt.Errorf("failed to get manifest of %s: %w", ref, err)
+	}
+	image.Digest = manifest.Digest
+	image.MediaType = manifest.MediaType
+	image.Platforms = manifest.Platforms()
+
+	if manifest.IsIndex() {
+		manifest, err = cr.Manifest(ctx, ref, platform, ctr)
+		if err != nil {
+			return fmt.Errorf("failed to get manifest of %s for platform %s: %w", ref, platform, err)
+		}
+	}
+	image.Size = manifest.Size()
+
+	config, err := cr.Config(ctx, ref, platform, ctr)
+	if err != nil {
+		return fmt.Errorf("failed to get config of %s: %w", ref, err)
+	}
+	image.Created = config.Created
+
+	return nil
+}
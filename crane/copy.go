@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// Copy copies an image from a source reference to a destination reference,
+// optionally across registries.
+// The source can also be a Dagger container, which is pushed to the destination.
+// Use WithRegistryAuth to authenticate to both the source and destination registries.
+// Returns the digest of the destination image - or an empty string when copying all tags.
+func (c *Crane) Copy(
+	ctx context.Context,
+	// source image reference
+	// format: <repository>:<tag> or <repository>@<digest>
+	// or just <repository> when copying all tags
+	// +optional
+	source string,
+	// source container, instead of a source image reference
+	// +optional
+	container *dagger.Container,
+	// destination image reference
+	// format: <repository>:<tag>
+	// or just <repository> when copying all tags
+	destination string,
+	// copy all tags from the source repository to the destination repository
+	// +optional
+	// +default=false
+	allTags bool,
+	// only copy the given platforms
+	// with a single platform, the platform-specific image is copied
+	// with multiple platforms, a filtered index is pushed to the destination
+	// default to the Crane platform - or all platforms
+	// format: os/arch[/variant]
+	// +optional
+	platforms []string,
+	// do not overwrite the destination tags if they already exist
+	// +optional
+	// +default=false
+	noClobber bool,
+	// maximum number of concurrent copies
+	// default to the crane default (GOMAXPROCS)
+	// not supported with multiple platforms
+	// +optional
+	jobs int,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	if container != nil {
+		if source != "" || allTags || len(platforms) > 0 {
+			return "", fmt.Errorf("cannot copy a container with a source image, all tags or platforms")
+		}
+		return c.copyContainer(ctx, container, destination, noClobber, ctr)
+	}
+	if source == "" {
+		return "", fmt.Errorf("either a source image or a container is required")
+	}
+
+	if allTags && len(platforms) > 1 {
+		return "", fmt.Errorf("cannot copy all tags with multiple platforms")
+	}
+	if jobs > 0 && len(platforms) > 1 {
+		return "", fmt.Errorf("cannot set the number of concurrent copies with multiple platforms")
+	}
+
+	if len(platforms) > 1 {
+		// crane index filter has no --no-clobber flag
+		if noClobber {
+			if err := c.checkNoClobber(ctx, destination, ctr); err != nil {
+				return "", err
+			}
+		}
+
+		args := []string{
+			"index", "filter",
+			source,
+			"--tag", destination,
+		}
+		for _, platform := range platforms {
+			args = append(args, "--platform", platform)
+		}
+		if _, err := c.WithPlatform("").Run(ctx, args, ctr); err != nil {
+			return "", fmt.Errorf("failed to run crane index filter: %w", err)
+		}
+		return c.WithPlatform("").Digest(ctx, destination, "", ctr)
+	}
+
+	cr := c
+	if len(platforms) == 1 {
+		cr = c.WithPlatform(platforms[0])
+	}
+
+	args := []string{
+		"copy",
+		source,
+		destination,
+	}
+	if allTags {
+		args = append(args, "--all-tags")
+	}
+	if noClobber {
+		args = append(args, "--no-clobber")
+	}
+	if jobs > 0 {
+		args = append(args, "--jobs", strconv.Itoa(jobs))
+	}
+
+	if _, err := cr.Run(ctx, args, ctr); err != nil {
+		return "", fmt.Errorf("failed to run crane copy: %w", err)
+	}
+	if allTags {
+		return "", nil
+	}
+
+	// the copied image is the platform-specific one, so resolve its digest without platform
+	return c.WithPlatform("").Digest(ctx, destination, "", ctr)
+}
+
+// copyContainer pushes a container to the destination,
+// unless the destination already exists and noClobber is set.
+func (c *Crane) copyContainer(ctx context.Context, container *dagger.Container, destination string, noClobber bool, ctr *dagger.Container) (string, error) {
+	if noClobber {
+		if err := c.checkNoClobber(ctx, destination, ctr); err != nil {
+			return "", err
+		}
+	}
+
+	return c.PushTarball(ctx, container.AsTarball(), destination, ctr)
+}
+
+// checkNoClobber returns an error if the destination already exists,
+// like crane copy with --no-clobber.
+func (c *Crane) checkNoClobber(ctx context.Context, destination string, ctr *dagger.Container) error {
+	check, err := c.checkImage(ctx, destination, ctr)
+	if err != nil {
+		return err
+	}
+	if check.Exists {
+		return fmt.Errorf("refusing to clobber existing tag %s@%s", destination, check.Digest)
+	}
+	return nil
+}
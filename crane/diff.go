@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// ImageDiff is the difference between a base image and a target image.
+type ImageDiff struct {
+	// base image reference
+	Base string
+	// target image reference
+	Target string
+	// platform used to compare the images
+	Platform string
+	// digest of the base image
+	BaseDigest string
+	// digest of the target image
+	TargetDigest string
+	// total size of the base image, in bytes
+	BaseSize int
+	// total size of the target image, in bytes
+	TargetSize int
+	// changes in the image config
+	ConfigChanges []*ConfigChange
+	// number of layers shared by both images
+	CommonLayers int
+	// layers present only in the target image
+	AddedLayers []*LayerDiff
+	// layers present only in the base image
+	RemovedLayers []*LayerDiff
+}
+
+// ConfigChange is a change of a single field of the image config.
+type ConfigChange struct {
+	// name of the field, such as "User", "Env.PATH" or "Label.org.opencontainers.image.version"
+	Field string
+	// value in the base image - empty if the field was added
+	Base string
+	// value in the target image - empty if the field was removed
+	Target string
+}
+
+// LayerDiff describes a layer present in only one of the compared images.
+type LayerDiff struct {
+	// digest of the layer
+	Digest string
+	// size of the layer, in bytes
+	Size int
+	// files added or modified by the layer
+	Files []string
+	// files deleted by the layer (whiteout files)
+	DeletedFiles []string
+}
+
+// HasChanges returns true if the images are different.
+func (d *ImageDiff) HasChanges() bool {
+	return d.BaseDigest != d.TargetDigest
+}
+
+// Json returns the JSON representation of the diff.
+func (d *ImageDiff) Json() (string, error) { //nolint:stylecheck // we want to name it "json"
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal image diff: %w", err)
+	}
+	return string(data), nil
+}
+
+// Markdown returns a Markdown rendering of the diff,
+// suitable for a merge request comment.
+func (d *ImageDiff) Markdown() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "## Image diff\n\n")
+	fmt.Fprintf(&sb, "`%s` → `%s`", d.Base, d.Target)
+	if d.Platform != "" {
+		fmt.Fprintf(&sb, " (%s)", d.Platform)
+	}
+	fmt.Fprintf(&sb, "\n\n")
+
+	if !d.HasChanges() {
+		fmt.Fprintf(&sb, "No changes: both images have the same digest `%s`.\n", d.BaseDigest)
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "| | Base | Target |\n|---|---|---|\n")
+	fmt.Fprintf(&sb, "| Digest | `%s` | `%s` |\n", d.BaseDigest, d.TargetDigest)
+	fmt.Fprintf(&sb, "| Size | %s | %s (%s) |\n\n",
+		humanSize(d.BaseSize), humanSize(d.TargetSize), humanSizeDelta(d.TargetSize-d.BaseSize))
+
+	fmt.Fprintf(&sb, "### Config\n\n")
+	if len(d.ConfigChanges) == 0 {
+		fmt.Fprintf(&sb, "No changes.\n\n")
+	} else {
+		fmt.Fprintf(&sb, "| Field | Base | Target |\n|---|---|---|\n")
+		for _, change := range d.ConfigChanges {
+			fmt.Fprintf(&sb, "| `%s` | %s | %s |\n", change.Field, markdownCode(change.Base), markdownCode(change.Target))
+		}
+		fmt.Fprintf(&sb, "\n")
+	}
+
+	fmt.Fprintf(&sb, "### Layers\n\n")
+	fmt.Fprintf(&sb, "%d layers in common, %d added, %d removed.\n\n", d.CommonLayers, len(d.AddedLayers), len(d.RemovedLayers))
+	writeLayers := func(title string, layers []*LayerDiff) {
+		for _, layer := range layers {
+			fmt.Fprintf(&sb, "<details><summary>%s <code>%s</code> (%s)</summary>\n\n", title, layer.Digest, humanSize(layer.Size))
+			for _, file := range layer.Files {
+				fmt.Fprintf(&sb, "- `%s`\n", file)
+			}
+			for _, file := range layer.DeletedFiles {
+				fmt.Fprintf(&sb, "- ~~`%s`~~\n", file)
+			}
+			fmt.Fprintf(&sb, "\n</details>\n\n")
+		}
+	}
+	writeLayers("Added", d.AddedLayers)
+	writeLayers("Removed", d.RemovedLayers)
+
+	return sb.String()
+}
+
+// Diff compares a base image with a target image,
+// and reports the differences in their config and layers.
+// If the images are indexes, the platform-specific images are compared
+// - using the Crane platform, or linux/amd64 by default.
+// The base and target can also be Dagger containers, reported as "container".
+func (c *Crane) Diff(
+	ctx context.Context,
+	// base image reference
+	// format: <repository>:<tag> or <repository>@<digest>
+	// +optional
+	base string,
+	// base container, instead of a base image reference
+	// +optional
+	baseContainer *dagger.Container,
+	// target image reference
+	// format: <repository>:<tag> or <repository>@<digest>
+	// +optional
+	target string,
+	// target container, instead of a target image reference
+	// +optional
+	targetContainer *dagger.Container,
+	// list the files added, modified or deleted by each added or removed layer
+	// this requires downloading these layers
+	// +optional
+	// +default=true
+	includeFiles bool,
+	// +optional
+	ctr *dagger.Container,
+) (*ImageDiff, error) {
+	if (base == "") == (baseContainer == nil) {
+		return nil, fmt.Errorf("either a base image or a base container is required")
+	}
+	if (target == "") == (targetContainer == nil) {
+		return nil, fmt.Errorf("either a target image or a target container is required")
+	}
+
+	platform := c.Platform
+	baseName, targetName := base, target
+	if baseContainer != nil || targetContainer != nil {
+		registry, err := c.startSourceRegistry(ctx, ctr)
+		if err != nil {
+			return nil, err
+		}
+		defer registry.stop(ctx)
+		ctr = registry.ctr
+
+		for _, source := range []struct {
+			name      string
+			image     *string
+			container *dagger.Container
+		}{
+			{name: "base", image: &base, container: baseContainer},
+			{name: "target", image: &target, container: targetContainer},
+		} {
+			if source.container == nil {
+				continue
+			}
+			if *source.image, err = registry.push(ctx, source.name, source.container); err != nil {
+				return nil, err
+			}
+			if platform == "" {
+				containerPlatform, err := source.container.Platform(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get platform of %s container: %w", source.name, err)
+				}
+				platform = string(containerPlatform)
+			}
+		}
+		if baseContainer != nil {
+			baseName = "container"
+		}
+		if targetContainer != nil {
+			targetName = "container"
+		}
+	}
+	if platform == "" {
+		platform = "linux/amd64"
+	}
+
+	baseManifest, err := c.Manifest(ctx, base, platform, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest of %s: %w", base, err)
+	}
+	targetManifest, err := c.Manifest(ctx, target, platform, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest of %s: %w", target, err)
+	}
+
+	diff := &ImageDiff{
+		Base:         baseName,
+		Target:       targetName,
+		Platform:     platform,
+		BaseDigest:   baseManifest.Digest,
+		TargetDigest: targetManifest.Digest,
+		BaseSize:     baseManifest.Size(),
+		TargetSize:   targetManifest.Size(),
+	}
+	if !diff.HasChanges() {
+		diff.CommonLayers = len(baseManifest.Layers)
+		return diff, nil
+	}
+
+	baseConfig, err := c.Config(ctx, base, platform, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config of %s: %w", base, err)
+	}
+	targetConfig, err := c.Config(ctx, target, platform, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config of %s: %w", target, err)
+	}
+	diff.ConfigChanges = diffConfigs(baseConfig, targetConfig)
+
+	diff.AddedLayers, diff.CommonLayers = diffLayers(baseManifest.Layers, targetManifest.Layers)
+	diff.RemovedLayers, _ = diffLayers(targetManifest.Layers, baseManifest.Layers)
+
+	if includeFiles {
+		for _, layers := range []struct {
+			repository string
+			layers     []*LayerDiff
+		}{
+			{repository: repositoryOf(target), layers: diff.AddedLayers},
+			{repository: repositoryOf(base), layers: diff.RemovedLayers},
+		} {
+			for _, layer := range layers.layers {
+				layer.Files, layer.DeletedFiles, err = c.layerFiles(ctx, layers.repository, layer.Digest, ctr)
+				if err != nil {
+					return nil, fmt.Errorf("failed to list files of layer %s: %w", layer.Digest, err)
+				}
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+// layerFiles returns the files added or modified by a layer, and the files it deletes.
+func (c *Crane) layerFiles(ctx context.Context, repository, digest string, ctr *dagger.Container) ([]string, []string, error) {
+	layer, err := c.blob(ctx, repository, digest, ctr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, err := dag.Container().From(baseWolfiImage).
+		WithExec([]string{"apk", "add", "--no-cache", "tar", "gzip", "zstd"}).
+		WithMountedFile("/tmp/layer", layer).
+		WithExec([]string{"tar", "-tf", "/tmp/layer"}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files, deletedFiles []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasSuffix(line, "/") {
+			continue
+		}
+		file := "/" + strings.TrimPrefix(line, "./")
+		dir, name := path.Split(file)
+		switch {
+		case name == ".wh..wh..opq":
+			// opaque whiteout: the content of the directory is replaced
+			deletedFiles = append(deletedFiles, dir+"*")
+		case strings.HasPrefix(name, ".wh."):
+			deletedFiles = append(deletedFiles, dir+strings.TrimPrefix(name, ".wh."))
+		default:
+			files = append(files, file)
+		}
+	}
+	return files, deletedFiles, nil
+}
+
+// diffLayers returns the layers present only in the target, and the number of layers in common.
+func diffLayers(base, target []*Descriptor) ([]*LayerDiff, int) {
+	var (
+		added  []*LayerDiff
+		common int
+	)
+	for _, layer := range target {
+		if slices.ContainsFunc(base, func(l *Descriptor) bool { return l.Digest == layer.Digest }) {
+			common++
+			continue
+		}
+		added = append(added, &LayerDiff{
+			Digest: layer.Digest,
+			Size:   layer.Size,
+		})
+	}
+	return added, common
+}
+
+// diffConfigs returns the changes between two image configs.
+func diffConfigs(base, target *ImageConfig) []*ConfigChange {
+	var changes []*ConfigChange
+	addChange := func(field, baseValue, targetValue string) {
+		if baseValue != targetValue {
+			changes = append(changes, &ConfigChange{
+				Field:  field,
+				Base:   baseValue,
+				Target: targetValue,
+			})
+		}
+	}
+
+	addChange("Platform", base.Platform, target.Platform)
+	addChange("User", base.User, target.User)
+	addChange("WorkingDir", base.WorkingDir, target.WorkingDir)
+	addChange("Entrypoint", strings.Join(base.Entrypoint, " "), strings.Join(target.Entrypoint, " "))
+	addChange("Cmd", strings.Join(base.Cmd, " "), strings.Join(target.Cmd, " "))
+	addChange("ExposedPorts", strings.Join(base.ExposedPorts, " "), strings.Join(target.ExposedPorts, " "))
+
+	for _, key := range unionKeys(envKeyValues(base.Env), envKeyValues(target.Env)) {
+		addChange("Env."+key, base.EnvVariable(key), target.EnvVariable(key))
+	}
+	for _, key := range unionKeys(base.Labels, target.Labels) {
+		addChange("Label."+key, base.Label(key), target.Label(key))
+	}
+
+	return changes
+}
+
+// envKeyValues converts a list of KEY=VALUE environment variables to key/value pairs.
+func envKeyValues(env []string) []*KeyValue {
+	var kvs []*KeyValue
+	for _, e := range env {
+		key, value, _ := strings.Cut(e, "=")
+		kvs = append(kvs, &KeyValue{Key: key, Value: value})
+	}
+	return kvs
+}
+
+// unionKeys returns the sorted keys present in any of the given lists.
+func unionKeys(lists ...[]*KeyValue) []string {
+	var keys []string
+	for _, kvs := range lists {
+		for _, kv := range kvs {
+			if !slices.Contains(keys, kv.Key) {
+				keys = append(keys, kv.Key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// markdownCode wraps a non-empty value in a Markdown code span.
+func markdownCode(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(value, "|", "\\|") + "`"
+}
+
+// humanSize returns a human-readable size, such as "12.3 MB".
+func humanSize(size int) string {
+	const unit = 1000
+	if size < unit && size > -unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit || value <= -unit {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "kMGTPE"[exp])
+}
+
+// humanSizeDelta returns a human-readable size difference, such as "+1.2 MB".
+func humanSizeDelta(delta int) string {
+	if delta > 0 {
+		return "+" + humanSize(delta)
+	}
+	return humanSize(delta)
+}
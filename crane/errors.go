@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// kinds of registry errors, included in the error messages
+// so that the callers of the module can branch on them.
+const (
+	RegistryErrorUnauthorized    = "unauthorized"
+	RegistryErrorNotFound        = "not-found"
+	RegistryErrorManifestUnknown = "manifest-unknown"
+	RegistryErrorRateLimited     = "rate-limited"
+	RegistryErrorNetwork         = "network"
+	RegistryErrorUnknown         = "unknown"
+)
+
+const (
+	defaultMaxAttempts   = 3
+	defaultRetryInterval = 2 * time.Second
+)
+
+// sentinel errors, to use with errors.Is
+var (
+	ErrUnauthorized    = &RegistryError{Kind: RegistryErrorUnauthorized}
+	ErrNotFound        = &RegistryError{Kind: RegistryErrorNotFound}
+	ErrManifestUnknown = &RegistryError{Kind: RegistryErrorManifestUnknown}
+	ErrRateLimited     = &RegistryError{Kind: RegistryErrorRateLimited}
+	ErrNetwork         = &RegistryError{Kind: RegistryErrorNetwork}
+)
+
+// registryErrorPatterns are the markers of each kind of error in the crane output:
+// the error codes of the OCI distribution spec, the HTTP statuses and the Go network errors.
+// The order matters: the first matching kind wins.
+var registryErrorPatterns = []struct {
+	kind     string
+	patterns []string
+}{
+	{
+		kind:     RegistryErrorRateLimited,
+		patterns: []string{"TOOMANYREQUESTS", "429 Too Many Requests", "rate limit"},
+	},
+	{
+		kind:     RegistryErrorUnauthorized,
+		patterns: []string{"UNAUTHORIZED", "DENIED", "401 Unauthorized", "403 Forbidden"},
+	},
+	{
+		kind:     RegistryErrorManifestUnknown,
+		patterns: []string{"MANIFEST_UNKNOWN"},
+	},
+	{
+		kind:     RegistryErrorNotFound,
+		patterns: []string{"NAME_UNKNOWN", "NOT_FOUND", "404 Not Found"},
+	},
+	{
+		kind: RegistryErrorNetwork,
+		patterns: []string{
+			"dial tcp", "no such host", "connection refused", "connection reset by peer",
+			"i/o timeout", "TLS handshake timeout", "unexpected EOF",
+			"UNAVAILABLE", "500 Internal Server Error", "502 Bad Gateway", "503 Service Unavailable", "504 Gateway Timeout",
+		},
+	},
+}
+
+// RegistryError is an error returned by the crane CLI while talking to a registry.
+// Its message starts with its kind, such as "unauthorized: crane ls: ...",
+// and the functions of the module wrap it with their context,
+// such as "failed to run crane ls: unauthorized: crane ls: ...".
+// The message is the only part of the error kept across Dagger module calls.
+type RegistryError struct {
+	// kind of error: unauthorized, not-found, manifest-unknown, rate-limited, network or unknown
+	Kind string
+	// crane command which failed, such as "ls"
+	Command string
+	// error message from the crane CLI
+	Message string
+	// underlying error
+	Err error
+}
+
+func (e *RegistryError) Error() string {
+	return e.Kind + ": crane " + e.Command + ": " + e.Message
+}
+
+func (e *RegistryError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel errors, such as ErrNotFound, on their kind.
+func (e *RegistryError) Is(target error) bool {
+	t, ok := target.(*RegistryError)
+	return ok && t.Command == "" && t.Kind == e.Kind
+}
+
+// Temporary returns true if the operation can be retried:
+// for rate limits and network errors.
+func (e *RegistryError) Temporary() bool {
+	return e.Kind == RegistryErrorRateLimited || e.Kind == RegistryErrorNetwork
+}
+
+// WithRetry returns a new Crane instance retrying the crane commands
+// failing with a rate limit or a network error.
+// The interval between 2 attempts doubles after each attempt.
+// By default, commands are attempted 3 times, starting with a 2s interval.
+func (c *Crane) WithRetry(
+	// maximum number of attempts for a command
+	// use 1 to disable retries
+	maxAttempts int,
+	// initial duration between 2 attempts
+	// +optional
+	// +default="2s"
+	interval string,
+) (*Crane, error) {
+	if _, err := time.ParseDuration(interval); err != nil {
+		return nil, fmt.Errorf("invalid interval %q: %w", interval, err)
+	}
+
+	cr := c.clone()
+	cr.MaxAttempts = maxAttempts
+	cr.RetryInterval = interval
+	return cr, nil
+}
+
+// retry runs fn until it succeeds, fails with an error which is not temporary,
+// or the maximum number of attempts is reached.
+// Each new attempt runs in a crane container bypassing the Dagger cache,
+// so that a failure captured by a previous attempt is not returned again.
+func (c *Crane) retry(ctx context.Context, ctr *dagger.Container, fn func(ctr *dagger.Container) error) error {
+	if ctr == nil {
+		var err error
+		if ctr, err = c.Container(ctx); err != nil {
+			return err
+		}
+	}
+
+	maxAttempts := c.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	wait := defaultRetryInterval
+	if c.RetryInterval != "" {
+		var err error
+		if wait, err = time.ParseDuration(c.RetryInterval); err != nil {
+			return fmt.Errorf("invalid retry interval %q: %w", c.RetryInterval, err)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptCtr := ctr
+		if attempt > 1 {
+			attemptCtr = ctr.WithEnvVariable("CRANE_RETRY_ATTEMPT", time.Now().Format(time.RFC3339Nano))
+		}
+
+		err := fn(attemptCtr)
+		var registryErr *RegistryError
+		if err == nil || attempt >= maxAttempts || !errors.As(err, &registryErr) || !registryErr.Temporary() {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// registryError converts the error of a crane execution into a RegistryError.
+// Errors which are not execution errors - such as engine errors - are returned as is.
+func registryError(args []string, err error) error {
+	var execErr *dagger.ExecError
+	if !errors.As(err, &execErr) {
+		return err
+	}
+	return newRegistryError(args, execErr.Stderr, err)
+}
+
+// newRegistryError returns a RegistryError for the given crane error output.
+func newRegistryError(args []string, stderr string, err error) *RegistryError {
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
+	message := errorMessage(stderr)
+	if message == "" && err != nil {
+		message = err.Error()
+	}
+	return &RegistryError{
+		Kind:    registryErrorKind(stderr),
+		Command: command,
+		Message: message,
+		Err:     err,
+	}
+}
+
+// registryErrorKind returns the kind of error matching the crane error output.
+func registryErrorKind(stderr string) string {
+	for _, kind := range registryErrorPatterns {
+		for _, pattern := range kind.patterns {
+			if strings.Contains(stderr, pattern) {
+				return kind.kind
+			}
+		}
+	}
+	return RegistryErrorUnknown
+}
+
+// errorMessage returns the error message from the crane error output:
+// the last line, without the "Error: " prefix added by the CLI.
+func errorMessage(stderr string) string {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	return strings.TrimPrefix(strings.TrimSpace(lines[len(lines)-1]), "Error: ")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewRegistryError(t *testing.T) {
+	tests := []struct {
+		name            string
+		stderr          string
+		expectedKind    string
+		expectedMessage string
+	}{
+		{
+			name: "head then get",
+			stderr: "2025/07/29 19:13:20 HEAD request failed, falling back on GET: HEAD https://registry.example.com/v2/app/manifests/v9: unexpected status code 404 Not Found (HEAD responses have no body, use GET for details)\n" +
+				"Error: GET https://registry.example.com/v2/app/manifests/v9: MANIFEST_UNKNOWN: manifest unknown; map[Tag:v9]\n",
+			expectedKind:    RegistryErrorManifestUnknown,
+			expectedMessage: "GET https://registry.example.com/v2/app/manifests/v9: MANIFEST_UNKNOWN: manifest unknown; map[Tag:v9]",
+		},
+		{
+			name:            "name unknown",
+			stderr:          "Error: reading tags for registry.example.com/unknown: GET https://registry.example.com/v2/unknown/tags/list: NAME_UNKNOWN: repository name not known to registry; map[name:unknown]\n",
+			expectedKind:    RegistryErrorNotFound,
+			expectedMessage: "reading tags for registry.example.com/unknown: GET https://registry.example.com/v2/unknown/tags/list: NAME_UNKNOWN: repository name not known to registry; map[name:unknown]",
+		},
+		{
+			name:            "unauthorized",
+			stderr:          "Error: GET https://registry.example.com/v2/app/tags/list: UNAUTHORIZED: authentication required; [map[Action:pull Class: Name:app Type:repository]]\n",
+			expectedKind:    RegistryErrorUnauthorized,
+			expectedMessage: "GET https://registry.example.com/v2/app/tags/list: UNAUTHORIZED: authentication required; [map[Action:pull Class: Name:app Type:repository]]",
+		},
+		{
+			name:            "rate limited",
+			stderr:          "Error: GET https://index.docker.io/v2/library/alpine/manifests/3.20: TOOMANYREQUESTS: You have reached your pull rate limit.\n",
+			expectedKind:    RegistryErrorRateLimited,
+			expectedMessage: "GET https://index.docker.io/v2/library/alpine/manifests/3.20: TOOMANYREQUESTS: You have reached your pull rate limit.",
+		},
+		{
+			name:            "network",
+			stderr:          "Error: Get \"https://registry.example.com/v2/\": dial tcp: lookup registry.example.com: no such host\n",
+			expectedKind:    RegistryErrorNetwork,
+			expectedMessage: "Get \"https://registry.example.com/v2/\": dial tcp: lookup registry.example.com: no such host",
+		},
+		{
+			name:            "unknown",
+			stderr:          "Error: parsing reference \"Invalid\": repository name must be lowercase\n",
+			expectedKind:    RegistryErrorUnknown,
+			expectedMessage: "parsing reference \"Invalid\": repository name must be lowercase",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newRegistryError([]string{"digest", "registry.example.com/app:v9"}, test.stderr, nil)
+			if err.Kind != test.expectedKind {
+				t.Errorf("expected kind %q, got %q", test.expectedKind, err.Kind)
+			}
+			if err.Message != test.expectedMessage {
+				t.Errorf("expected message %q, got %q", test.expectedMessage, err.Message)
+			}
+			if expected := test.expectedKind + ": crane digest: " + test.expectedMessage; err.Error() != expected {
+				t.Errorf("expected error %q, got %q", expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestRegistryErrorIs(t *testing.T) {
+	err := fmt.Errorf("failed to run crane ls: %w", &RegistryError{
+		Kind:    RegistryErrorNotFound,
+		Command: "ls",
+		Message: "NAME_UNKNOWN: repository name not known to registry",
+	})
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v to be ErrNotFound", err)
+	}
+	if errors.Is(err, ErrManifestUnknown) {
+		t.Errorf("expected %v not to be ErrManifestUnknown", err)
+	}
+}
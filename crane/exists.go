@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+	"golang.org/x/sync/errgroup"
+)
+
+// ImageCheck is the result of an image existence check.
+type ImageCheck struct {
+	// image reference, as given
+	Image string
+	// true if the image exists
+	Exists bool
+	// digest of the image - empty if it does not exist
+	Digest string
+}
+
+// ImageTagExists checks if the given image exists.
+// It relies on a single HEAD request on the manifest, instead of listing all the tags of the repository.
+func (c *Crane) ImageTagExists(
+	ctx context.Context,
+	// image to check
+	// format: <repository>:<tag>, <repository>@<digest> or <repository> for the latest tag
+	image string,
+	// +optional
+	ctr *dagger.Container,
+) (bool, error) {
+	check, err := c.checkImage(ctx, image, ctr)
+	if err != nil {
+		return false, err
+	}
+	return check.Exists, nil
+}
+
+// CheckImages checks concurrently if the given images exist, and returns their digests.
+func (c *Crane) CheckImages(
+	ctx context.Context,
+	// images to check
+	// format: <repository>:<tag>, <repository>@<digest> or <repository> for the latest tag
+	images []string,
+	// maximum number of images checked concurrently
+	// +optional
+	// +default=8
+	concurrency int,
+	// +optional
+	ctr *dagger.Container,
+) ([]*ImageCheck, error) {
+	checks := make([]*ImageCheck, len(images))
+
+	eg, ctx := errgroup.WithContext(ctx)
+	if concurrency > 0 {
+		eg.SetLimit(concurrency)
+	}
+	for i, image := range images {
+		eg.Go(func() error {
+			check, err := c.checkImage(ctx, image, ctr)
+			if err != nil {
+				return err
+			}
+			checks[i] = check
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	return checks, nil
+}
+
+// checkImage resolves the digest of an image with a HEAD request,
+// and reports the image as missing if the registry answers that the manifest is unknown.
+func (c *Crane) checkImage(ctx context.Context, image string, ctr *dagger.Container) (*ImageCheck, error) {
+	ref, err := parseReference(image)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &ImageCheck{
+		Image: image,
+	}
+	args := []string{"digest", ref.String()}
+	err = c.retry(ctx, ctr, func(ctr *dagger.Container) error {
+		// without platform, crane digest only sends a HEAD request
+		ctr = c.WithPlatform("").exec(args, ctr, dagger.ContainerWithExecOpts{
+			Expect: dagger.ReturnTypeAny,
+		})
+
+		exitCode, err := ctr.ExitCode(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to run crane digest: %w", err)
+		}
+
+		if exitCode == 0 {
+			stdout, err := ctr.Stdout(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to run crane digest: %w", err)
+			}
+			check.Exists = true
+			check.Digest = strings.TrimSpace(stdout)
+			return nil
+		}
+
+		stderr, err := ctr.Stderr(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to run crane digest: %w", err)
+		}
+		return newRegistryError(args, stderr, nil)
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrManifestUnknown) {
+		return check, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check image %s: %w", image, err)
+	}
+	return check, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// Export returns the flattened filesystem of a remote image, as a directory.
+// If the image is an index, the platform-specific image is exported
+// - using the Crane platform, or linux/amd64 by default.
+func (c *Crane) Export(
+	ctx context.Context,
+	// image reference to export
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// +optional
+	ctr *dagger.Container,
+) (*dagger.Directory, error) {
+	ctr, err := c.runOutput(ctx, []string{
+		"export",
+		image,
+		tarballPath,
+	}, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run crane export: %w", err)
+	}
+
+	return dag.Container().From(baseWolfiImage).
+		WithMountedFile("/tmp/fs.tar", ctr.File(tarballPath)).
+		WithExec([]string{"mkdir", "-p", "/fs"}).
+		WithExec([]string{"tar", "-xf", "/tmp/fs.tar", "-C", "/fs", "--no-same-owner"}).
+		Directory("/fs"), nil
+}
+
+// ExtractFile returns a single file from the filesystem of a remote image,
+// such as /etc/os-release or a binary.
+// Symlinks are resolved within the image filesystem.
+func (c *Crane) ExtractFile(
+	ctx context.Context,
+	// image reference to extract the file from
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// absolute path of the file in the image
+	path string,
+	// +optional
+	ctr *dagger.Container,
+) (*dagger.File, error) {
+	fs, err := c.Export(ctx, image, ctr)
+	if err != nil {
+		return nil, err
+	}
+	return fs.File(strings.TrimPrefix(path, "/")), nil
+}
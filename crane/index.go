@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// Index allows you to create and modify multi-platform image indexes.
+func (c *Crane) Index(
+	// reference of the index
+	// format: <repository>:<tag>
+	reference string,
+) *Index {
+	return &Index{
+		Crane:     c,
+		Reference: reference,
+	}
+}
+
+// Index allows you to create and modify multi-platform image indexes.
+type Index struct {
+	// +private
+	Crane     *Crane
+	Reference string
+}
+
+// Append appends images to the index, and pushes the resulting OCI image index.
+// Images can be given as remote references, or as Dagger containers
+// - which are first pushed to the repository of the index, with a platform-specific tag
+// such as <tag>-linux-amd64.
+// The platform of each image is read from its config.
+// Returns the digest of the index.
+func (idx *Index) Append(
+	ctx context.Context,
+	// remote images to append to the index
+	// format: <repository>:<tag> or <repository>@<digest>
+	// +optional
+	images []string,
+	// containers to append to the index
+	// +optional
+	containers []*dagger.Container,
+	// existing index to append the images to
+	// default to an empty OCI index
+	// +optional
+	base string,
+	// use an empty Docker manifest list as base instead of an empty OCI index
+	// ignored if a base is given
+	// +optional
+	// +default=false
+	dockerEmptyBase bool,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	if len(images) == 0 && len(containers) == 0 {
+		return "", fmt.Errorf("at least one image or container is required")
+	}
+
+	cr := idx.Crane.WithPlatform("")
+	if ctr == nil {
+		var err error
+		if ctr, err = cr.Container(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	manifests := slices.Clone(images)
+	for i, container := range containers {
+		platform, err := container.Platform(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to get platform of container %d: %w", i, err)
+		}
+
+		image := platformImageReference(idx.Reference, string(platform))
+		if _, err := cr.PushTarball(ctx, container.AsTarball(), image, ctr); err != nil {
+			return "", fmt.Errorf("failed to push container for platform %s: %w", platform, err)
+		}
+
+		manifests = append(manifests, image)
+	}
+
+	args := []string{
+		"index", "append",
+		"--tag", idx.Reference,
+	}
+	if base != "" {
+		args = append(args, base)
+	} else if dockerEmptyBase {
+		args = append(args, "--docker-empty-base")
+	}
+	for _, manifest := range manifests {
+		args = append(args, "--manifest", manifest)
+	}
+
+	if _, err := cr.Run(ctx, args, ctr); err != nil {
+		return "", fmt.Errorf("failed to run crane index append: %w", err)
+	}
+
+	return cr.Digest(ctx, idx.Reference, "", ctr)
+}
+
+// Filter filters the index down to the given platforms, and pushes the resulting index.
+// Returns the digest of the filtered index.
+func (idx *Index) Filter(
+	ctx context.Context,
+	// platforms to keep in the index
+	// format: os/arch[/variant]
+	platforms []string,
+	// reference to push the filtered index to
+	// default to the index reference - replacing the index
+	// format: <repository>:<tag>
+	// +optional
+	destination string,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	if len(platforms) == 0 {
+		return "", fmt.Errorf("at least one platform is required")
+	}
+	if destination == "" {
+		destination = idx.Reference
+	}
+
+	args := []string{
+		"index", "filter",
+		idx.Reference,
+		"--tag", destination,
+	}
+	for _, platform := range platforms {
+		args = append(args, "--platform", platform)
+	}
+
+	cr := idx.Crane.WithPlatform("")
+	if _, err := cr.Run(ctx, args, ctr); err != nil {
+		return "", fmt.Errorf("failed to run crane index filter: %w", err)
+	}
+
+	return cr.Digest(ctx, destination, "", ctr)
+}
+
+// Manifest returns the manifest of the index.
+func (idx *Index) Manifest(
+	ctx context.Context,
+	// +optional
+	ctr *dagger.Container,
+) (*ImageManifest, error) {
+	return idx.Crane.WithPlatform("").Manifest(ctx, idx.Reference, "", ctr)
+}
+
+// platformImageReference returns the reference of a platform-specific image,
+// by suffixing the tag of the given reference with the platform.
+// For example: registry.example.com/app:v1 and linux/arm64 gives registry.example.com/app:v1-linux-arm64
+func platformImageReference(reference, platform string) string {
+	ref, err := parseReference(reference)
+	if err != nil {
+		ref = &imageReference{Repository: reference}
+	}
+	tag := ref.Tag
+	if tag == "" {
+		tag = defaultTag
+	}
+	return ref.Repository + ":" + tag + "-" + strings.ReplaceAll(platform, "/", "-")
+}
+
+// rebuildIndex runs a crane command on each platform-specific image of an index,
+// and pushes a new index of the resulting images to the tag - default to the index reference.
+// The command is built by argsFn, for the reference of the platform-specific image
+// and the target repository, where it must push the resulting image by digest.
+// Attestation manifests are dropped, because they reference the digests of the original images.
+// Returns the digest of the new index.
+func (c *Crane) rebuildIndex(ctx context.Context, index *ImageManifest, tag string, ctr *dagger.Container, argsFn func(image, target string) []string) (string, error) {
+	if tag == "" {
+		ref, err := parseReference(index.Reference)
+		if err != nil {
+			return "", err
+		}
+		if ref.Digest != "" {
+			return "", fmt.Errorf("a tag is required to replace the index %s referenced by digest", index.Reference)
+		}
+		tag = index.Reference
+	}
+
+	var (
+		repository = repositoryOf(index.Reference)
+		target     = repositoryOf(tag)
+		args       = []string{"index", "append", "--tag", tag}
+	)
+	if index.MediaType == mediaTypeDockerList {
+		args = append(args, "--docker-empty-base")
+	}
+	for _, desc := range index.Manifests {
+		if desc.Platform == "" || desc.Platform == "unknown/unknown" {
+			// attestation manifests
+			continue
+		}
+
+		cmd := argsFn(repository+"@"+desc.Digest, target)
+		output, err := c.WithPlatform(desc.Platform).Run(ctx, cmd, ctr)
+		if err != nil {
+			return "", fmt.Errorf("failed to run crane %s for platform %s: %w", cmd[0], desc.Platform, err)
+		}
+		args = append(args, "--manifest", target+"@"+digestOf(output))
+	}
+	if !slices.Contains(args, "--manifest") {
+		return "", fmt.Errorf("no platform-specific image in the index %s", index.Reference)
+	}
+
+	cr := c.WithPlatform("")
+	if _, err := cr.Run(ctx, args, ctr); err != nil {
+		return "", fmt.Errorf("failed to run crane index append: %w", err)
+	}
+
+	return cr.Digest(ctx, tag, "", ctr)
+}
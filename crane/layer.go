@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// Append appends new layers on top of a remote base image, and pushes the resulting image.
+// Layers can be given as directories - their content is added at the given path in the image -
+// or as tarballs.
+// The base image can also be a Dagger container.
+// Returns the digest of the new image.
+func (c *Crane) Append(
+	ctx context.Context,
+	// base image reference to append the layers to
+	// format: <repository>:<tag> or <repository>@<digest>
+	// +optional
+	base string,
+	// base container to append the layers to, instead of a base image reference
+	// +optional
+	baseContainer *dagger.Container,
+	// tag to push the new image to
+	// format: <repository>:<tag>
+	tag string,
+	// directories to add as new layers - one layer per directory
+	// +optional
+	directories []*dagger.Directory,
+	// path in the image where the content of the directories is added
+	// +optional
+	// +default="/"
+	path string,
+	// tarballs to add as new layers - one layer per tarball
+	// +optional
+	tarballs []*dagger.File,
+	// set the base image annotations (org.opencontainers.image.base.*) on the new image,
+	// so that it can be rebased later
+	// ignored for a base container, which has no remote reference
+	// +optional
+	// +default=true
+	setBaseImageAnnotations bool,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	for _, dir := range directories {
+		tarballs = append(tarballs, layerTarball(dir, path))
+	}
+	if len(tarballs) == 0 {
+		return "", fmt.Errorf("at least one directory or tarball is required")
+	}
+
+	switch {
+	case base != "" && baseContainer != nil:
+		return "", fmt.Errorf("cannot append to both a base image and a base container")
+	case baseContainer != nil:
+		registry, err := c.startSourceRegistry(ctx, ctr)
+		if err != nil {
+			return "", err
+		}
+		defer registry.stop(ctx)
+		if base, err = registry.push(ctx, "base", baseContainer); err != nil {
+			return "", err
+		}
+		ctr = registry.ctr
+	case base == "":
+		return "", fmt.Errorf("either a base image or a base container is required")
+	}
+	if ctr == nil {
+		var err error
+		if ctr, err = c.Container(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	args := []string{
+		"append",
+		"--base", base,
+		"--new_tag", tag,
+	}
+	if setBaseImageAnnotations && baseContainer == nil {
+		args = append(args, "--set-base-image-annotations")
+	}
+	for i, tarball := range tarballs {
+		layer := "/tmp/crane/layers/" + strconv.Itoa(i) + ".tar"
+		ctr = ctr.WithMountedFile(layer, tarball)
+		args = append(args, "--new_layer", layer)
+	}
+
+	output, err := c.Run(ctx, args, ctr)
+	if err != nil {
+		return "", fmt.Errorf("failed to run crane append: %w", err)
+	}
+
+	return digestOf(output), nil
+}
+
+// Rebase rebases a remote image onto a new base image, and pushes the resulting image.
+// The layers of the old base are replaced by the layers of the new base,
+// the other layers of the image are kept as is.
+// If the old and new bases are not given, they are read from the image annotations
+// (org.opencontainers.image.base.name and org.opencontainers.image.base.digest).
+// crane does not rebase an index (OCI index or Docker manifest list): each platform-specific image
+// is rebased onto the same platform of the bases instead, and a new index of the rebased images is pushed.
+// Attestation manifests are dropped, because they reference the digests of the original images.
+// Returns the digest of the rebased image - or index.
+func (c *Crane) Rebase(
+	ctx context.Context,
+	// image reference to rebase
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// old base image of the image
+	// default to the base image from the image annotations
+	// +optional
+	oldBase string,
+	// new base image to rebase the image onto
+	// default to the latest digest of the base image from the image annotations
+	// +optional
+	newBase string,
+	// tag to push the rebased image to
+	// default to the image reference - replacing the image
+	// format: <repository>:<tag>
+	// +optional
+	tag string,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	var flags []string
+	if oldBase != "" {
+		flags = append(flags, "--old_base", oldBase)
+	}
+	if newBase != "" {
+		flags = append(flags, "--new_base", newBase)
+	}
+
+	// with the Crane platform, crane would replace a multi-platform tag by a single rebased platform
+	manifest, err := c.WithPlatform("").Manifest(ctx, image, "", ctr)
+	if err != nil {
+		return "", err
+	}
+	if manifest.IsIndex() {
+		return c.rebuildIndex(ctx, manifest, tag, ctr, func(image, target string) []string {
+			// a tag with a digest makes crane push the rebased image by digest
+			return append([]string{"rebase", image, "--tag", target + "@" + digestOf(image)}, flags...)
+		})
+	}
+
+	args := []string{
+		"rebase",
+		image,
+	}
+	if tag != "" {
+		args = append(args, "--tag", tag)
+	}
+
+	output, err := c.Run(ctx, append(args, flags...), ctr)
+	if err != nil {
+		return "", fmt.Errorf("failed to run crane rebase: %w", err)
+	}
+
+	return digestOf(output), nil
+}
+
+// layerTarball returns a tarball of the given directory,
+// with its content located at the given path.
+func layerTarball(dir *dagger.Directory, dest string) *dagger.File {
+	root := path.Join("/layer", dest)
+	return dag.Container().From(baseWolfiImage).
+		WithMountedDirectory(root, dir).
+		WithExec([]string{"tar", "-cf", "/tmp/layer.tar", "-C", "/layer", "."}).
+		File("/tmp/layer.tar")
+}
+
+// blob returns a blob (layer, config) of a repository, as a file.
+func (c *Crane) blob(ctx context.Context, repository, digest string, ctr *dagger.Container) (*dagger.File, error) {
+	ctr, err := c.runOutput(ctx, []string{
+		"blob",
+		repository + "@" + digest,
+	}, ctr, dagger.ContainerWithExecOpts{
+		RedirectStdout: blobPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to run crane blob: %w", err)
+	}
+
+	return ctr.File(blobPath), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+const (
+	// directory of the files written by crane
+	outputDir   = "/tmp/crane"
+	layoutPath  = outputDir + "/layout"
+	tarballPath = outputDir + "/image.tar"
+	blobPath    = outputDir + "/blob"
+)
+
+// PullLayout pulls a remote image into a directory, in the OCI image layout format.
+// If the image is an index, all its platforms are pulled - unless the Crane platform is set.
+// See https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+func (c *Crane) PullLayout(
+	ctx context.Context,
+	// image reference to pull
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// +optional
+	ctr *dagger.Container,
+) (*dagger.Directory, error) {
+	ctr, err := c.runOutput(ctx, []string{
+		"pull",
+		"--format", "oci",
+		image,
+		layoutPath,
+	}, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run crane pull: %w", err)
+	}
+
+	return ctr.Directory(layoutPath), nil
+}
+
+// PullTarball pulls a remote image into a tarball file,
+// compatible with `docker load`.
+func (c *Crane) PullTarball(
+	ctx context.Context,
+	// image reference to pull
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// +optional
+	ctr *dagger.Container,
+) (*dagger.File, error) {
+	ctr, err := c.runOutput(ctx, []string{
+		"pull",
+		"--format", "tarball",
+		image,
+		tarballPath,
+	}, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run crane pull: %w", err)
+	}
+
+	return ctr.File(tarballPath), nil
+}
+
+// PushLayout pushes a directory in the OCI image layout format to a remote image.
+// Returns the digest of the pushed image.
+func (c *Crane) PushLayout(
+	ctx context.Context,
+	// directory in the OCI image layout format
+	layout *dagger.Directory,
+	// image reference to push to
+	// format: <repository>:<tag>
+	image string,
+	// push all the images of the layout as a single index
+	// required if the layout contains multiple images
+	// +optional
+	// +default=false
+	index bool,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	if ctr == nil {
+		var err error
+		if ctr, err = c.Container(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	args := []string{
+		"push",
+		layoutPath,
+		image,
+	}
+	if index {
+		args = append(args, "--index")
+	}
+
+	output, err := c.Run(ctx, args, ctr.WithMountedDirectory(layoutPath, layout))
+	if err != nil {
+		return "", fmt.Errorf("failed to run crane push: %w", err)
+	}
+
+	return digestOf(output), nil
+}
+
+// PushTarball pushes an image tarball to a remote image.
+// The tarball can be produced by `docker save`, PullTarball, or Container.AsTarball.
+// Returns the digest of the pushed image.
+func (c *Crane) PushTarball(
+	ctx context.Context,
+	// image tarball
+	tarball *dagger.File,
+	// image reference to push to
+	// format: <repository>:<tag>
+	image string,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	if ctr == nil {
+		var err error
+		if ctr, err = c.Container(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	output, err := c.Run(ctx, []string{
+		"push",
+		tarballPath,
+		image,
+	}, ctr.WithMountedFile(tarballPath, tarball))
+	if err != nil {
+		return "", fmt.Errorf("failed to run crane push: %w", err)
+	}
+
+	return digestOf(output), nil
+}
+
+// runOutput runs a crane command writing its output to a file, like Run,
+// and returns the container holding the written file.
+func (c *Crane) runOutput(ctx context.Context, args []string, ctr *dagger.Container, opts ...dagger.ContainerWithExecOpts) (*dagger.Container, error) {
+	if ctr == nil {
+		var err error
+		if ctr, err = c.Container(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// crane creates the files it writes, but not their parent directory
+	ctr = ctr.WithDirectory(outputDir, dag.Directory())
+
+	var output *dagger.Container
+	err := c.retry(ctx, ctr, func(ctr *dagger.Container) error {
+		var err error
+		output, err = c.exec(args, ctr, opts...).Sync(ctx)
+		return registryError(args, err)
+	})
+	return output, err
+}
@@ -7,6 +7,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/vbehar/daggerverse/crane/internal/dagger"
@@ -19,6 +20,15 @@ const (
 	// and to retrieve its creation time: `crane config cgr.dev/chainguard/crane:latest | jq .created`
 	// This one is from 2025-07-29T19:13:20Z
 	baseCraneImage = "cgr.dev/chainguard/crane:latest@sha256:c76c9e921a90bdd1634456ca928d398c66f4b0e52ba342ab4de424b2abf2d0f9"
+
+	// the base wolfi image, used to manipulate files: https://images.chainguard.dev/directory/image/wolfi-base/overview
+	// retrieve the latest sha256 hash with: `crane digest cgr.dev/chainguard/wolfi-base:latest`
+	// and to retrieve its creation time: `crane config cgr.dev/chainguard/wolfi-base:latest | jq .created`
+	// This one is from 2025-06-02T17:31:02Z
+	baseWolfiImage = "cgr.dev/chainguard/wolfi-base:latest@sha256:57428116d2d7c27d1d4de4103e19b40bb8d2942ff6dff31b900e55efedeb7e30"
+
+	// directory of the additional CA certificates
+	caCertsDir = "/tmp/crane/certs"
 )
 
 // Crane is a Dagger Module to interact with the Crane CLI.
@@ -28,6 +38,16 @@ type Crane struct {
 	Password *dagger.Secret
 	Insecure bool
 	Platform string
+	// additional registries to authenticate to, on top of the main registry
+	RegistryAuths []*RegistryAuth
+	// existing Docker config.json, used as a base for the registries authentication
+	BaseDockerConfig *dagger.Secret
+	// CA certificates (PEM bundle) trusted in addition to the system ones
+	CaBundle *dagger.File
+	// maximum number of attempts for the commands failing with a temporary error
+	MaxAttempts int
+	// initial duration between 2 attempts
+	RetryInterval string
 }
 
 func New(
@@ -47,17 +67,29 @@ func New(
 	// default to all platforms
 	// +optional
 	platform string,
+	// existing Docker config.json to use for authentication with the registries
+	// the other credentials are added to it
+	// +optional
+	dockerConfig *dagger.Secret,
+	// CA certificates (PEM bundle) to trust in addition to the system ones
+	// use it to connect to registries signed by a private CA
+	// +optional
+	caBundle *dagger.File,
 ) *Crane {
 	return &Crane{
-		Registry: registry,
-		Username: username,
-		Password: password,
-		Insecure: insecure,
-		Platform: platform,
+		Registry:         registry,
+		Username:         username,
+		Password:         password,
+		Insecure:         insecure,
+		Platform:         platform,
+		BaseDockerConfig: dockerConfig,
+		CaBundle:         caBundle,
 	}
 }
 
 // Login returns a new Crane instance with the given registry and credentials.
+// It replaces the main registry - so several Login calls do not accumulate -
+// but keeps the additional registries: use WithRegistryAuth to add registries.
 func (c *Crane) Login(
 	// registry to authenticate to
 	registry string,
@@ -66,13 +98,11 @@ func (c *Crane) Login(
 	// password to use for authentication with the registry
 	password *dagger.Secret,
 ) *Crane {
-	return &Crane{
-		Registry: registry,
-		Username: username,
-		Password: password,
-		Insecure: c.Insecure,
-		Platform: c.Platform,
-	}
+	cr := c.clone()
+	cr.Registry = registry
+	cr.Username = username
+	cr.Password = password
+	return cr
 }
 
 // WithPlatform returns a new Crane instance with the given platform.
@@ -82,36 +112,54 @@ func (c *Crane) WithPlatform(
 	// platform to request when listing images
 	platform string,
 ) *Crane {
-	return &Crane{
-		Registry: c.Registry,
-		Username: c.Username,
-		Password: c.Password,
-		Insecure: c.Insecure,
-		Platform: platform,
-	}
+	cr := c.clone()
+	cr.Platform = platform
+	return cr
+}
+
+// WithCaBundle returns a new Crane instance trusting the given CA certificates,
+// in addition to the system ones.
+// Use it to connect to registries signed by a private CA, while keeping TLS verification.
+// Note that client certificates are not supported by the crane CLI.
+func (c *Crane) WithCaBundle(
+	// CA certificates (PEM bundle)
+	caBundle *dagger.File,
+) *Crane {
+	cr := c.clone()
+	cr.CaBundle = caBundle
+	return cr
 }
 
 // Container returns a container with the Crane CLI installed
-// and the registry configured - if a registry and credentials are provided.
-func (c *Crane) Container() *dagger.Container {
+// and the registries configured - if registries and credentials are provided.
+// The Docker config.json holding the credentials is mounted as a secret.
+func (c *Crane) Container(ctx context.Context) (*dagger.Container, error) {
 	ctr := dag.Container().From(baseCraneImage)
 
-	if c.Registry != "" {
-		ctr = ctr.WithEnvVariable("REGISTRY_HOST", c.Registry)
+	if c.CaBundle != nil {
+		// the Go TLS stack loads the certificates of all the files in SSL_CERT_DIR,
+		// on top of the system bundle
+		ctr = ctr.
+			WithMountedFile(caCertsDir+"/ca-bundle.crt", c.CaBundle).
+			WithEnvVariable("SSL_CERT_DIR", "/etc/ssl/certs:"+caCertsDir)
 	}
-	if c.Username != "" && c.Password != nil {
+
+	if c.hasAuth() {
+		config, err := c.DockerConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
 		ctr = ctr.
-			WithEnvVariable("REGISTRY_USERNAME", c.Username).
-			WithSecretVariable("REGISTRY_PASSWORD", c.Password).
-			WithExec([]string{
-				"/bin/sh", "-c",
-				"crane auth login --username $REGISTRY_USERNAME --password $REGISTRY_PASSWORD $REGISTRY_HOST",
-			})
+			WithEnvVariable("DOCKER_CONFIG", dockerConfigDir).
+			WithMountedSecret(dockerConfigDir+"/config.json", config)
 	}
-	return ctr
+	return ctr, nil
 }
 
 // Run runs the crane CLI with the given arguments.
+// Registry failures are returned as a RegistryError, whose message starts with the kind of failure:
+// unauthorized, not-found, manifest-unknown, rate-limited, network or unknown.
+// Rate limits and network errors are retried - see WithRetry.
 func (c *Crane) Run(
 	ctx context.Context,
 	// arguments to pass to the glab CLI
@@ -122,10 +170,18 @@ func (c *Crane) Run(
 	// +optional
 	ctr *dagger.Container,
 ) (string, error) {
-	if ctr == nil {
-		ctr = c.Container()
-	}
+	var stdout string
+	err := c.retry(ctx, ctr, func(ctr *dagger.Container) error {
+		var err error
+		stdout, err = c.exec(args, ctr).Stdout(ctx)
+		return registryError(args, err)
+	})
+	return stdout, err
+}
 
+// exec returns a container running the crane CLI with the given arguments,
+// so that its output files can be retrieved.
+func (c *Crane) exec(args []string, ctr *dagger.Container, opts ...dagger.ContainerWithExecOpts) *dagger.Container {
 	if c.Platform != "" {
 		args = append([]string{"--platform", c.Platform}, args...)
 	}
@@ -133,12 +189,15 @@ func (c *Crane) Run(
 		args = append([]string{"--insecure"}, args...)
 	}
 
+	var opt dagger.ContainerWithExecOpts
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	opt.UseEntrypoint = true
+
 	return ctr.
 		WithEntrypoint([]string{"crane"}).
-		WithExec(args, dagger.ContainerWithExecOpts{
-			UseEntrypoint: true,
-		}).
-		Stdout(ctx)
+		WithExec(args, opt)
 }
 
 // Ls lists the images in the given repository.
@@ -173,33 +232,19 @@ func (c *Crane) Ls(
 		return nil, fmt.Errorf("failed to run crane ls: %w", err)
 	}
 
-	result := strings.Split(output, "\n")
+	var result []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
 	return result, nil
 }
 
-// ImageTagExists checks if the given image tag exists.
-func (c *Crane) ImageTagExists(
-	ctx context.Context,
-	// image to check
-	// format: <repository>:<tag>
-	image string,
-	// +optional
-	ctr *dagger.Container,
-) (bool, error) {
-	repository, tag, ok := strings.Cut(image, ":")
-	if !ok {
-		return false, fmt.Errorf("invalid image format: %s", image)
-	}
-
-	allTags, err := c.Ls(ctx, repository, false, true, ctr)
-	if err != nil {
-		return false, fmt.Errorf("failed to list tags: %w", err)
-	}
-
-	for _, t := range allTags {
-		if t == tag {
-			return true, nil
-		}
-	}
-	return false, nil
+// clone returns a shallow copy of the Crane instance,
+// that can be safely modified without affecting the original one.
+func (c *Crane) clone() *Crane {
+	cr := *c
+	cr.RegistryAuths = slices.Clone(c.RegistryAuths)
+	return &cr
 }
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+const (
+	mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList  = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// ImageManifest is the manifest of an image - or of an image index (OCI index or Docker manifest list).
+type ImageManifest struct {
+	// reference of the image
+	Reference string
+	// digest of the manifest
+	Digest string
+	// media type of the manifest
+	MediaType string
+	// artifact type of the manifest - for artifacts such as signatures or SBOMs
+	ArtifactType string
+	// schema version of the manifest
+	SchemaVersion int
+	// descriptor of the image config - empty for an index
+	Config *Descriptor
+	// layers of the image - empty for an index
+	Layers []*Descriptor
+	// platform-specific manifests - only for an index
+	Manifests []*Descriptor
+	// annotations of the manifest
+	Annotations []*KeyValue
+}
+
+// Descriptor describes a content (layer, config, manifest) stored in a registry.
+type Descriptor struct {
+	// media type of the content
+	MediaType string
+	// digest of the content
+	Digest string
+	// size of the content, in bytes
+	Size int
+	// artifact type of the content - for the manifests of an index, such as referrers
+	ArtifactType string
+	// platform of the content - only for the manifests of an index
+	// format: os/arch[/variant]
+	Platform string
+	// annotations of the content
+	Annotations []*KeyValue
+}
+
+// ImageConfig is the config of an image.
+type ImageConfig struct {
+	// reference of the image
+	Reference string
+	// platform of the image
+	// format: os/arch[/variant]
+	Platform string
+	// creation time of the image, in RFC 3339 format
+	Created string
+	// author of the image
+	Author string
+	// labels of the image
+	Labels []*KeyValue
+	// environment variables of the image
+	// format: KEY=VALUE
+	Env []string
+	// entrypoint of the image
+	Entrypoint []string
+	// default command of the image
+	Cmd []string
+	// user of the image
+	User string
+	// working directory of the image
+	WorkingDir string
+	// exposed ports of the image
+	ExposedPorts []string
+}
+
+// KeyValue is a simple key/value pair, used for labels and annotations.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// IsIndex returns true if the manifest is an image index (OCI index or Docker manifest list).
+func (m *ImageManifest) IsIndex() bool {
+	return isIndexMediaType(m.MediaType)
+}
+
+// Platforms returns the platforms of the manifests of an index.
+// Returns an empty list if the manifest is not an index.
+func (m *ImageManifest) Platforms() []string {
+	var platforms []string
+	for _, desc := range m.Manifests {
+		if desc.Platform != "" {
+			platforms = append(platforms, desc.Platform)
+		}
+	}
+	return platforms
+}
+
+// Size returns the total size of the image (config and layers), in bytes.
+// For an index, it returns the total size of the referenced manifests.
+func (m *ImageManifest) Size() int {
+	size := 0
+	if m.Config != nil {
+		size += m.Config.Size
+	}
+	for _, layer := range m.Layers {
+		size += layer.Size
+	}
+	for _, desc := range m.Manifests {
+		size += desc.Size
+	}
+	return size
+}
+
+// Annotation returns the value of the given annotation, or an empty string if it is not set.
+func (m *ImageManifest) Annotation(
+	// name of the annotation
+	name string,
+) string {
+	return valueOf(m.Annotations, name)
+}
+
+// Label returns the value of the given label, or an empty string if it is not set.
+func (c *ImageConfig) Label(
+	// name of the label
+	name string,
+) string {
+	return valueOf(c.Labels, name)
+}
+
+// EnvVariable returns the value of the given environment variable, or an empty string if it is not set.
+func (c *ImageConfig) EnvVariable(
+	// name of the environment variable
+	name string,
+) string {
+	for _, env := range c.Env {
+		if key, value, _ := strings.Cut(env, "="); key == name {
+			return value
+		}
+	}
+	return ""
+}
+
+// Manifest returns the manifest of the given image.
+// If the image is an index (OCI index or Docker manifest list) and a platform is requested
+// - either with the platform argument or the Crane platform - the manifest of this platform is returned.
+// Otherwise, the index itself is returned, with its platform-specific manifests.
+func (c *Crane) Manifest(
+	ctx context.Context,
+	// image reference
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// platform to resolve if the image is an index
+	// default to the Crane platform
+	// format: os/arch[/variant]
+	// +optional
+	platform string,
+	// +optional
+	ctr *dagger.Container,
+) (*ImageManifest, error) {
+	if platform == "" {
+		platform = c.Platform
+	}
+	cr := c.WithPlatform(platform)
+
+	output, err := cr.Run(ctx, []string{"manifest", image}, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run crane manifest: %w", err)
+	}
+
+	var raw ociManifest
+	if err = json.Unmarshal([]byte(output), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest of %s: %w", image, err)
+	}
+
+	digest, err := cr.Digest(ctx, image, platform, ctr)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &ImageManifest{
+		Reference:     image,
+		Digest:        digest,
+		MediaType:     raw.MediaType,
+		ArtifactType:  raw.ArtifactType,
+		SchemaVersion: raw.SchemaVersion,
+		Annotations:   keyValues(raw.Annotations),
+	}
+	if manifest.MediaType == "" {
+		// the media type is optional in OCI manifests
+		if len(raw.Manifests) > 0 {
+			manifest.MediaType = mediaTypeOCIIndex
+		} else {
+			manifest.MediaType = mediaTypeOCIManifest
+		}
+	}
+	if raw.Config != nil {
+		manifest.Config = raw.Config.toDescriptor()
+	}
+	for _, layer := range raw.Layers {
+		manifest.Layers = append(manifest.Layers, layer.toDescriptor())
+	}
+	for _, desc := range raw.Manifests {
+		manifest.Manifests = append(manifest.Manifests, desc.toDescriptor())
+	}
+
+	return manifest, nil
+}
+
+// Config returns the config of the given image.
+// If the image is an index (OCI index or Docker manifest list),
+// the config of the requested platform is returned
+// - either with the platform argument or the Crane platform.
+// If no platform is requested, crane defaults to linux/amd64.
+func (c *Crane) Config(
+	ctx context.Context,
+	// image reference
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// platform to resolve if the image is an index
+	// default to the Crane platform
+	// format: os/arch[/variant]
+	// +optional
+	platform string,
+	// +optional
+	ctr *dagger.Container,
+) (*ImageConfig, error) {
+	if platform == "" {
+		platform = c.Platform
+	}
+
+	output, err := c.WithPlatform(platform).Run(ctx, []string{"config", image}, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run crane config: %w", err)
+	}
+
+	var raw ociConfigFile
+	if err = json.Unmarshal([]byte(output), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config of %s: %w", image, err)
+	}
+
+	config := &ImageConfig{
+		Reference:  image,
+		Platform:   formatPlatform(raw.OS, raw.Architecture, raw.Variant),
+		Created:    raw.Created,
+		Author:     raw.Author,
+		Labels:     keyValues(raw.Config.Labels),
+		Env:        raw.Config.Env,
+		Entrypoint: raw.Config.Entrypoint,
+		Cmd:        raw.Config.Cmd,
+		User:       raw.Config.User,
+		WorkingDir: raw.Config.WorkingDir,
+	}
+	for port := range raw.Config.ExposedPorts {
+		config.ExposedPorts = append(config.ExposedPorts, port)
+	}
+	sort.Strings(config.ExposedPorts)
+
+	return config, nil
+}
+
+// Digest returns the digest of the given image.
+// If the image is an index (OCI index or Docker manifest list) and a platform is requested
+// - either with the platform argument or the Crane platform - the digest of this platform's manifest is returned.
+// Otherwise, the digest of the index itself is returned.
+func (c *Crane) Digest(
+	ctx context.Context,
+	// image reference
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// platform to resolve if the image is an index
+	// default to the Crane platform
+	// format: os/arch[/variant]
+	// +optional
+	platform string,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	if platform == "" {
+		platform = c.Platform
+	}
+
+	output, err := c.WithPlatform(platform).Run(ctx, []string{"digest", image}, ctr)
+	if err != nil {
+		return "", fmt.Errorf("failed to run crane digest: %w", err)
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// ociManifest is the raw JSON representation of an OCI/Docker manifest or index.
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        *ociDescriptor    `json:"config,omitempty"`
+	Layers        []ociDescriptor   `json:"layers,omitempty"`
+	Manifests     []ociDescriptor   `json:"manifests,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int               `json:"size"`
+	Platform     *ociPlatform      `json:"platform,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ociConfigFile is the raw JSON representation of an image config.
+type ociConfigFile struct {
+	Created      string `json:"created,omitempty"`
+	Author       string `json:"author,omitempty"`
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	Config       struct {
+		User         string              `json:"User,omitempty"`
+		Env          []string            `json:"Env,omitempty"`
+		Entrypoint   []string            `json:"Entrypoint,omitempty"`
+		Cmd          []string            `json:"Cmd,omitempty"`
+		WorkingDir   string              `json:"WorkingDir,omitempty"`
+		Labels       map[string]string   `json:"Labels,omitempty"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	} `json:"config"`
+}
+
+func (d ociDescriptor) toDescriptor() *Descriptor {
+	desc := &Descriptor{
+		MediaType:    d.MediaType,
+		ArtifactType: d.ArtifactType,
+		Digest:       d.Digest,
+		Size:         d.Size,
+		Annotations:  keyValues(d.Annotations),
+	}
+	if d.Platform != nil {
+		desc.Platform = formatPlatform(d.Platform.OS, d.Platform.Architecture, d.Platform.Variant)
+	}
+	return desc
+}
+
+func isIndexMediaType(mediaType string) bool {
+	return mediaType == mediaTypeOCIIndex || mediaType == mediaTypeDockerList
+}
+
+func formatPlatform(os, arch, variant string) string {
+	if os == "" && arch == "" {
+		return ""
+	}
+	platform := os + "/" + arch
+	if variant != "" {
+		platform += "/" + variant
+	}
+	return platform
+}
+
+// keyValues converts a map to a list of key/value pairs, sorted by key.
+func keyValues(m map[string]string) []*KeyValue {
+	var kvs []*KeyValue
+	for key, value := range m {
+		kvs = append(kvs, &KeyValue{Key: key, Value: value})
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
+	return kvs
+}
+
+func valueOf(kvs []*KeyValue, key string) string {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// Mutate modifies the metadata of a remote image, without rebuilding it,
+// and pushes the result to a new tag - or to the same tag.
+// If the image is an index (OCI index or Docker manifest list), each platform-specific image is mutated,
+// and a new index of the mutated images is pushed. Attestation manifests are dropped,
+// because they reference the digests of the original images.
+// The image can also be a Dagger container, in which case the tag is required.
+// Returns the digest of the mutated image - or index.
+func (c *Crane) Mutate(
+	ctx context.Context,
+	// image reference to mutate
+	// format: <repository>:<tag> or <repository>@<digest>
+	// +optional
+	image string,
+	// container to mutate, instead of an image reference
+	// +optional
+	container *dagger.Container,
+	// new tag to push the mutated image to
+	// default to the image reference - replacing the image
+	// required when mutating a container
+	// format: <repository>:<tag>
+	// +optional
+	tag string,
+	// labels to set on the image config
+	// format: key=value
+	// +optional
+	labels []string,
+	// annotations to set on the image manifest
+	// format: key=value
+	// +optional
+	annotations []string,
+	// environment variables to set on the image config
+	// format: KEY=VALUE
+	// +optional
+	env []string,
+	// entrypoint to set on the image config
+	// +optional
+	entrypoint []string,
+	// default command to set on the image config
+	// +optional
+	cmd []string,
+	// user to set on the image config
+	// +optional
+	user string,
+	// working directory to set on the image config
+	// +optional
+	workdir string,
+	// ports to expose on the image config
+	// format: port[/protocol]
+	// +optional
+	exposedPorts []string,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	switch {
+	case image != "" && container != nil:
+		return "", fmt.Errorf("cannot mutate both an image and a container")
+	case container != nil && tag == "":
+		return "", fmt.Errorf("a tag is required to mutate a container")
+	case container != nil:
+		registry, err := c.startSourceRegistry(ctx, ctr)
+		if err != nil {
+			return "", err
+		}
+		defer registry.stop(ctx)
+		if image, err = registry.push(ctx, "source", container); err != nil {
+			return "", err
+		}
+		ctr = registry.ctr
+	case image == "":
+		return "", fmt.Errorf("either an image or a container is required")
+	}
+
+	var flags []string
+	for _, label := range labels {
+		flags = append(flags, "--label", mapFlagValue(label))
+	}
+	for _, annotation := range annotations {
+		flags = append(flags, "--annotation", mapFlagValue(annotation))
+	}
+	for _, e := range env {
+		// env values are used as is by crane: no quoting needed
+		flags = append(flags, "--env", e)
+	}
+	for _, e := range entrypoint {
+		flags = append(flags, "--entrypoint", sliceFlagValue(e))
+	}
+	for _, arg := range cmd {
+		flags = append(flags, "--cmd", sliceFlagValue(arg))
+	}
+	if user != "" {
+		flags = append(flags, "--user", user)
+	}
+	if workdir != "" {
+		flags = append(flags, "--workdir", workdir)
+	}
+	for _, port := range exposedPorts {
+		flags = append(flags, "--exposed-ports", sliceFlagValue(port))
+	}
+
+	if container == nil {
+		// crane mutates a single platform of an index: mutate each of them instead,
+		// so that a multi-platform tag is never replaced by a single-platform image
+		manifest, err := c.WithPlatform("").Manifest(ctx, image, "", ctr)
+		if err != nil {
+			return "", err
+		}
+		if manifest.IsIndex() {
+			return c.rebuildIndex(ctx, manifest, tag, ctr, func(image, target string) []string {
+				return append([]string{"mutate", image, "--repo", target}, flags...)
+			})
+		}
+	}
+
+	args := []string{
+		"mutate",
+		image,
+	}
+	if tag != "" {
+		args = append(args, "--tag", tag)
+	}
+
+	output, err := c.Run(ctx, append(args, flags...), ctr)
+	if err != nil {
+		return "", fmt.Errorf("failed to run crane mutate: %w", err)
+	}
+
+	return digestOf(output), nil
+}
+
+// sliceFlagValue quotes a value of a string slice flag,
+// which is parsed as CSV by crane: without quoting, its commas would split it.
+func sliceFlagValue(value string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	_ = w.Write([]string{value})
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// mapFlagValue quotes a key=value value of a string map flag,
+// which is parsed as CSV by crane when it contains more than one "=".
+func mapFlagValue(value string) string {
+	if strings.Count(value, "=") <= 1 {
+		return value
+	}
+	return sliceFlagValue(value)
+}
+
+// digestOf extracts the digest from the output of a crane command
+// that prints the pushed reference, such as registry.example.com/app@sha256:...
+func digestOf(output string) string {
+	output = strings.TrimSpace(output)
+	if _, digest, ok := strings.Cut(output, "@"); ok {
+		return digest
+	}
+	return output
+}
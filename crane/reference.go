@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const defaultTag = "latest"
+
+var (
+	// see https://github.com/distribution/reference/blob/main/reference.go for the grammar
+	registryRegexp      = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*|\[[a-fA-F0-9:]+\])(?::[0-9]+)?$`)
+	pathComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	tagRegexp           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp        = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// imageReference is a parsed image reference,
+// such as registry.example.com:5000/team/app:v1.2.3 or registry.example.com/app@sha256:...
+type imageReference struct {
+	// repository, including the registry - if any
+	Repository string
+	// tag - default to "latest" if neither a tag nor a digest is given
+	Tag string
+	// digest - if any
+	Digest string
+}
+
+// parseReference parses an image reference.
+// It supports registries with a port (host:5000/repo:tag), digests (repo@sha256:...),
+// both (repo:tag@sha256:...), and defaults to the "latest" tag.
+func parseReference(image string) (*imageReference, error) {
+	ref := &imageReference{}
+
+	name := image
+	if before, digest, ok := strings.Cut(image, "@"); ok {
+		if !digestRegexp.MatchString(digest) {
+			return nil, fmt.Errorf("invalid image reference %q: invalid digest %q", image, digest)
+		}
+		name, ref.Digest = before, digest
+	}
+
+	// the tag is after the last colon, but only if it is after the last slash
+	// to support registries with a port, such as localhost:5000/image
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+		if !tagRegexp.MatchString(ref.Tag) {
+			return nil, fmt.Errorf("invalid image reference %q: invalid tag %q", image, ref.Tag)
+		}
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+
+	components := strings.Split(name, "/")
+	for i, component := range components {
+		if i == 0 && len(components) > 1 && isRegistry(component) {
+			if !registryRegexp.MatchString(component) {
+				return nil, fmt.Errorf("invalid image reference %q: invalid registry %q", image, component)
+			}
+			continue
+		}
+		if !pathComponentRegexp.MatchString(component) {
+			return nil, fmt.Errorf("invalid image reference %q: invalid repository %q", image, name)
+		}
+	}
+	ref.Repository = name
+
+	return ref, nil
+}
+
+// String returns the canonical form of the reference:
+// <repository>:<tag>, <repository>@<digest> or <repository>:<tag>@<digest>.
+func (r *imageReference) String() string {
+	s := r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// isRegistry returns true if the first component of a reference is a registry hostname,
+// following the same rules as the Docker CLI.
+func isRegistry(component string) bool {
+	return strings.ContainsAny(component, ".:[") || component == "localhost" || strings.ToLower(component) != component
+}
+
+// repositoryOf returns the repository part of an image reference,
+// without the tag or digest.
+func repositoryOf(image string) string {
+	ref, err := parseReference(image)
+	if err != nil {
+		return image
+	}
+	return ref.Repository
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	const digest = "sha256:c76c9e921a90bdd1634456ca928d398c66f4b0e52ba342ab4de424b2abf2d0f9"
+
+	tests := []struct {
+		image    string
+		expected imageReference
+		invalid  bool
+	}{
+		{
+			image:    "alpine",
+			expected: imageReference{Repository: "alpine", Tag: "latest"},
+		},
+		{
+			image:    "host:5000/repo",
+			expected: imageReference{Repository: "host:5000/repo", Tag: "latest"},
+		},
+		{
+			image:    "host:5000/repo:tag",
+			expected: imageReference{Repository: "host:5000/repo", Tag: "tag"},
+		},
+		{
+			image:    "repo@" + digest,
+			expected: imageReference{Repository: "repo", Digest: digest},
+		},
+		{
+			image:    "repo:tag@" + digest,
+			expected: imageReference{Repository: "repo", Tag: "tag", Digest: digest},
+		},
+		{
+			image:    "registry.example.com/team/app:v1.2.3",
+			expected: imageReference{Repository: "registry.example.com/team/app", Tag: "v1.2.3"},
+		},
+		{
+			image:    "localhost/app",
+			expected: imageReference{Repository: "localhost/app", Tag: "latest"},
+		},
+		{
+			image:   "repo@sha256:short",
+			invalid: true,
+		},
+		{
+			image:   "repo:invalid/tag",
+			invalid: true,
+		},
+		{
+			image:   "host:5000/Repo",
+			invalid: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			ref, err := parseReference(test.image)
+			if test.invalid {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *ref != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, *ref)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// path of the Docker config.json in the referrers container
+	referrersDockerConfig = "/tmp/docker/config.json"
+
+	// referrersScript queries the OCI referrers API with curl, because the crane CLI does not support it.
+	// It implements the token authentication of the distribution spec, with the credentials of the Docker config.json,
+	// and prints the referrers index - or nothing if the registry does not support the API.
+	// See https://github.com/opencontainers/distribution-spec/blob/main/spec.md#listing-referrers
+	referrersScript = `
+set -eu
+
+scheme=https
+case "${REGISTRY_HOST%:*}" in
+	localhost|127.0.0.1|*.local) scheme=http ;;
+esac
+curl_opts="-sS"
+if [ "${INSECURE}" = "true" ]; then
+	curl_opts="${curl_opts} -k"
+fi
+if [ -f ` + caCertsDir + `/ca-bundle.crt ]; then
+	cat /etc/ssl/certs/ca-certificates.crt ` + caCertsDir + `/ca-bundle.crt > /tmp/ca-certificates.crt
+	curl_opts="${curl_opts} --cacert /tmp/ca-certificates.crt"
+fi
+
+url="${scheme}://${REGISTRY_HOST}/v2/${REPOSITORY_PATH}/referrers/${DIGEST}"
+accept="Accept: application/vnd.oci.image.index.v1+json"
+
+credential() {
+	[ -f ` + referrersDockerConfig + ` ] || return 0
+	jq -r --arg key "${CONFIG_KEY}" ".auths[\$key].$1 // empty" ` + referrersDockerConfig + `
+}
+
+code=$(curl ${curl_opts} -o /tmp/referrers.json -D /tmp/headers.txt -w '%{http_code}' -H "${accept}" "${url}")
+if [ "${code}" = "401" ]; then
+	challenge=$(grep -i '^www-authenticate:' /tmp/headers.txt | tr -d '\r' | cut -d' ' -f2-)
+	basic=$(credential auth)
+	case "${challenge}" in
+		Bearer*)
+			realm=$(echo "${challenge}" | sed -n 's/.*realm="\([^"]*\)".*/\1/p')
+			service=$(echo "${challenge}" | sed -n 's/.*service="\([^"]*\)".*/\1/p')
+			scope="repository:${REPOSITORY_PATH}:pull"
+			token=$(credential registrytoken)
+			identity=$(credential identitytoken)
+			if [ -n "${token}" ]; then
+				:
+			elif [ -n "${identity}" ]; then
+				token=$(curl ${curl_opts} -f -X POST "${realm}" \
+					--data-urlencode "grant_type=refresh_token" --data-urlencode "refresh_token=${identity}" \
+					--data-urlencode "service=${service}" --data-urlencode "scope=${scope}" \
+					--data-urlencode "client_id=crane" | jq -r '.access_token')
+			elif [ -n "${basic}" ]; then
+				token=$(curl ${curl_opts} -f -G "${realm}" -H "Authorization: Basic ${basic}" \
+					--data-urlencode "service=${service}" --data-urlencode "scope=${scope}" | jq -r '.token // .access_token')
+			else
+				token=$(curl ${curl_opts} -f -G "${realm}" \
+					--data-urlencode "service=${service}" --data-urlencode "scope=${scope}" | jq -r '.token // .access_token')
+			fi
+			authorization="Bearer ${token}"
+			;;
+		*)
+			authorization="Basic ${basic}"
+			;;
+	esac
+	code=$(curl ${curl_opts} -o /tmp/referrers.json -w '%{http_code}' -H "${accept}" -H "Authorization: ${authorization}" "${url}")
+fi
+
+if [ "${code}" = "200" ]; then
+	cat /tmp/referrers.json
+fi
+`
+)
+
+// referrers returns the descriptors of the manifests referring to the given digest,
+// using the OCI referrers API.
+// Returns false if the registry does not support the API.
+func (c *Crane) referrers(ctx context.Context, repository, digest string) ([]*Descriptor, bool, error) {
+	host, path, configKey := registryEndpoint(repository)
+
+	ctr := dag.Container().From(baseWolfiImage).
+		WithExec([]string{"apk", "add", "--no-cache", "curl", "jq"}).
+		WithEnvVariable("REGISTRY_HOST", host).
+		WithEnvVariable("REPOSITORY_PATH", path).
+		WithEnvVariable("DIGEST", digest).
+		WithEnvVariable("CONFIG_KEY", configKey).
+		WithEnvVariable("INSECURE", strconv.FormatBool(c.Insecure))
+	if c.CaBundle != nil {
+		ctr = ctr.WithMountedFile(caCertsDir+"/ca-bundle.crt", c.CaBundle)
+	}
+	if c.hasAuth() {
+		config, err := c.DockerConfig(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		ctr = ctr.WithMountedSecret(referrersDockerConfig, config)
+	}
+
+	output, err := ctr.
+		WithExec([]string{"/bin/sh", "-c", referrersScript}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query the referrers of %s@%s: %w", repository, digest, err)
+	}
+	if strings.TrimSpace(output) == "" {
+		return nil, false, nil
+	}
+
+	var index ociManifest
+	if err := json.Unmarshal([]byte(output), &index); err != nil {
+		return nil, false, fmt.Errorf("failed to parse the referrers of %s@%s: %w", repository, digest, err)
+	}
+	descriptors := make([]*Descriptor, 0, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		descriptors = append(descriptors, desc.toDescriptor())
+	}
+	return descriptors, true, nil
+}
+
+// registryEndpoint returns the host serving the registry API of a repository,
+// the path of the repository in the registry, and the key of its credentials in the Docker config.json.
+// Repositories without registry are on Docker Hub.
+func registryEndpoint(repository string) (host, path, configKey string) {
+	registry, path, ok := strings.Cut(repository, "/")
+	if !ok || !isRegistry(registry) {
+		registry, path = "docker.io", repository
+	}
+
+	host = registry
+	switch registry {
+	case "docker.io", "index.docker.io":
+		host = "registry-1.docker.io"
+		if !strings.Contains(path, "/") {
+			path = "library/" + path
+		}
+	}
+	return host, path, dockerConfigKey(registry)
+}
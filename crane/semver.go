@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// Versions lists the tags of a repository that are semantic versions,
+// sorted from the lowest to the highest version.
+// Tags that are not semantic versions (e.g., "latest" or "20240101") are ignored.
+// Versions must be complete (e.g., 1.2.3), with an optional "v" prefix.
+func (c *Crane) Versions(
+	ctx context.Context,
+	// repository to list versions from
+	repository string,
+	// only return versions matching this constraint
+	// example: ">=1.2 <2" or "~1.4"
+	// see https://github.com/Masterminds/semver#checking-version-constraints
+	// +optional
+	constraint string,
+	// include pre-release versions (e.g., 1.2.0-rc.1)
+	// pre-releases are matched against the constraint using their release version,
+	// so 1.2.0-rc.1 is matched as 1.2.0
+	// +optional
+	// +default=false
+	includePrereleases bool,
+	// +optional
+	ctr *dagger.Container,
+) ([]string, error) {
+	versions, err := c.versions(ctx, repository, constraint, includePrereleases, ctr)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(versions))
+	for _, version := range versions {
+		tags = append(tags, version.Original())
+	}
+	return tags, nil
+}
+
+// LatestVersion returns the tag of a repository with the highest semantic version.
+// Returns an empty string if no tag matches.
+func (c *Crane) LatestVersion(
+	ctx context.Context,
+	// repository to list versions from
+	repository string,
+	// only consider versions matching this constraint
+	// example: ">=1.2 <2" or "~1.4"
+	// see https://github.com/Masterminds/semver#checking-version-constraints
+	// +optional
+	constraint string,
+	// include pre-release versions (e.g., 1.2.0-rc.1)
+	// pre-releases are matched against the constraint using their release version,
+	// so 1.2.0-rc.1 is matched as 1.2.0
+	// +optional
+	// +default=false
+	includePrereleases bool,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	versions, err := c.versions(ctx, repository, constraint, includePrereleases, ctr)
+	if err != nil {
+		return "", err
+	}
+
+	if len(versions) == 0 {
+		return "", nil
+	}
+	return versions[len(versions)-1].Original(), nil
+}
+
+func (c *Crane) versions(
+	ctx context.Context,
+	repository string,
+	constraint string,
+	includePrereleases bool,
+	ctr *dagger.Container,
+) ([]*semver.Version, error) {
+	var (
+		versionConstraint *semver.Constraints
+		err               error
+	)
+	if constraint != "" {
+		if versionConstraint, err = semver.NewConstraint(constraint); err != nil {
+			return nil, fmt.Errorf("invalid constraint %q: %w", constraint, err)
+		}
+	}
+
+	tags, err := c.Ls(ctx, repository, false, true, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	var versions []*semver.Version
+	for _, tag := range tags {
+		version, err := parseVersion(tag)
+		if err != nil {
+			continue
+		}
+		if !matchVersion(version, versionConstraint, includePrereleases) {
+			continue
+		}
+		versions = append(versions, version)
+	}
+
+	sort.Stable(semver.Collection(versions))
+	return versions, nil
+}
+
+// parseVersion parses a tag as a strict semantic version, with an optional "v" prefix,
+// so that tags such as dates or build numbers are not mistaken for versions.
+// The original tag is kept as the original version.
+func parseVersion(tag string) (*semver.Version, error) {
+	if _, err := semver.StrictNewVersion(strings.TrimPrefix(tag, "v")); err != nil {
+		return nil, err
+	}
+	return semver.NewVersion(tag)
+}
+
+// matchVersion returns true if the version matches the constraint - if any.
+func matchVersion(version *semver.Version, constraint *semver.Constraints, includePrereleases bool) bool {
+	if version.Prerelease() == "" {
+		return constraint == nil || constraint.Check(version)
+	}
+	if !includePrereleases {
+		return false
+	}
+	if constraint == nil {
+		return true
+	}
+	release, err := version.SetPrerelease("")
+	if err != nil {
+		return false
+	}
+	return constraint.Check(&release)
+}
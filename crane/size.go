@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// SizeReport is a report of the sizes of one or more images, and of their layers.
+type SizeReport struct {
+	// sizes of the images, one per image and platform
+	Images []*ImageSize
+	// layers shared by multiple images or platforms
+	DuplicatedLayers []*LayerSize
+	// largest layers of all the images, sorted by decreasing compressed size
+	LargestLayers []*LayerSize
+}
+
+// ImageSize is the size of an image, for a single platform.
+type ImageSize struct {
+	// image reference
+	Image string
+	// platform of the image
+	Platform string
+	// digest of the platform-specific image
+	Digest string
+	// total compressed size (config and layers), in bytes - as stored in the registry
+	CompressedSize int
+	// total uncompressed size of the layers, in bytes - only if computed
+	UncompressedSize int
+	// layers of the image
+	Layers []*LayerSize
+}
+
+// LayerSize is the size of a layer.
+type LayerSize struct {
+	// digest of the layer
+	Digest string
+	// compressed size of the layer, in bytes
+	CompressedSize int
+	// uncompressed size of the layer, in bytes - only if computed
+	UncompressedSize int
+	// images using this layer
+	// format: <image> (<platform>)
+	UsedBy []string
+}
+
+// Json returns the JSON representation of the report.
+func (r *SizeReport) Json() (string, error) { //nolint:stylecheck // we want to name it "json"
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal size report: %w", err)
+	}
+	return string(data), nil
+}
+
+// Markdown returns a Markdown rendering of the report,
+// suitable for a merge request comment.
+func (r *SizeReport) Markdown() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "## Image sizes\n\n")
+	fmt.Fprintf(&sb, "| Image | Platform | Compressed | Uncompressed | Layers |\n|---|---|---|---|---|\n")
+	for _, image := range r.Images {
+		fmt.Fprintf(&sb, "| `%s` | %s | %s | %s | %d |\n",
+			image.Image, image.Platform, humanSize(image.CompressedSize), optionalHumanSize(image.UncompressedSize), len(image.Layers))
+	}
+	fmt.Fprintf(&sb, "\n")
+
+	if len(r.LargestLayers) > 0 {
+		fmt.Fprintf(&sb, "### Largest layers\n\n")
+		writeLayerSizes(&sb, r.LargestLayers)
+	}
+	if len(r.DuplicatedLayers) > 0 {
+		fmt.Fprintf(&sb, "### Duplicated layers\n\n")
+		writeLayerSizes(&sb, r.DuplicatedLayers)
+	}
+
+	return sb.String()
+}
+
+// Check returns an error if any image is bigger than the given compressed size.
+// Use it to fail a build when an image grows beyond a budget.
+func (r *SizeReport) Check(
+	// maximum compressed size of an image, in bytes
+	maxSize int,
+) error {
+	var oversized []string
+	for _, image := range r.Images {
+		if image.CompressedSize > maxSize {
+			oversized = append(oversized, fmt.Sprintf("%s (%s): %s", image.Image, image.Platform, humanSize(image.CompressedSize)))
+		}
+	}
+	if len(oversized) > 0 {
+		return fmt.Errorf("images bigger than %s: %s", humanSize(maxSize), strings.Join(oversized, ", "))
+	}
+	return nil
+}
+
+// Sizes computes the sizes of the given images, for all their platforms - or only the Crane platform.
+// The uncompressed sizes require downloading all the layers, so they are only computed on demand.
+func (c *Crane) Sizes(
+	ctx context.Context,
+	// images to report on
+	// format: <repository>:<tag> or <repository>@<digest>
+	images []string,
+	// compute the uncompressed size of the layers
+	// this requires downloading all the layers
+	// +optional
+	// +default=false
+	uncompressed bool,
+	// number of largest layers to report
+	// +optional
+	// +default=10
+	top int,
+	// +optional
+	ctr *dagger.Container,
+) (*SizeReport, error) {
+	var (
+		report = &SizeReport{}
+		layers = map[string]*LayerSize{}
+	)
+
+	for _, image := range images {
+		platforms := []string{c.Platform}
+		if c.Platform == "" {
+			manifest, err := c.Manifest(ctx, image, "", ctr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get manifest of %s: %w", image, err)
+			}
+			if manifest.IsIndex() {
+				platforms = nil
+				for _, platform := range manifest.Platforms() {
+					// skip the attestation manifests attached to the index
+					if platform != "unknown/unknown" {
+						platforms = append(platforms, platform)
+					}
+				}
+			}
+		}
+
+		for _, platform := range platforms {
+			manifest, err := c.Manifest(ctx, image, platform, ctr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get manifest of %s: %w", image, err)
+			}
+			if platform == "" {
+				config, err := c.Config(ctx, image, "", ctr)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get config of %s: %w", image, err)
+				}
+				platform = config.Platform
+			}
+
+			imageSize := &ImageSize{
+				Image:          image,
+				Platform:       platform,
+				Digest:         manifest.Digest,
+				CompressedSize: manifest.Size(),
+			}
+			for _, desc := range manifest.Layers {
+				layer, ok := layers[desc.Digest]
+				if !ok {
+					layer = &LayerSize{
+						Digest:         desc.Digest,
+						CompressedSize: desc.Size,
+					}
+					if uncompressed {
+						if layer.UncompressedSize, err = c.uncompressedSize(ctx, repositoryOf(image), desc.Digest, ctr); err != nil {
+							return nil, fmt.Errorf("failed to compute uncompressed size of layer %s: %w", desc.Digest, err)
+						}
+					}
+					layers[desc.Digest] = layer
+				}
+				layer.UsedBy = append(layer.UsedBy, image+" ("+platform+")")
+				imageSize.UncompressedSize += layer.UncompressedSize
+				imageSize.Layers = append(imageSize.Layers, layer)
+			}
+			report.Images = append(report.Images, imageSize)
+		}
+	}
+
+	for _, layer := range layers {
+		if len(layer.UsedBy) > 1 {
+			report.DuplicatedLayers = append(report.DuplicatedLayers, layer)
+		}
+		report.LargestLayers = append(report.LargestLayers, layer)
+	}
+	sortLayerSizes(report.DuplicatedLayers)
+	sortLayerSizes(report.LargestLayers)
+	if top >= 0 && len(report.LargestLayers) > top {
+		report.LargestLayers = report.LargestLayers[:top]
+	}
+
+	return report, nil
+}
+
+// uncompressedSize downloads a layer and returns its uncompressed size, in bytes.
+func (c *Crane) uncompressedSize(ctx context.Context, repository, digest string, ctr *dagger.Container) (int, error) {
+	layer, err := c.blob(ctx, repository, digest, ctr)
+	if err != nil {
+		return 0, err
+	}
+
+	output, err := dag.Container().From(baseWolfiImage).
+		WithExec([]string{"apk", "add", "--no-cache", "zstd"}).
+		WithMountedFile("/tmp/layer", layer).
+		WithExec([]string{"/bin/sh", "-c", `
+			magic=$(head -c4 /tmp/layer | od -An -tx1 | tr -d ' \n')
+			case "$magic" in
+				1f8b*) gzip -dc /tmp/layer | wc -c ;;
+				28b52ffd) zstd -dc /tmp/layer | wc -c ;;
+				*) wc -c < /tmp/layer ;;
+			esac
+		`}).
+		Stdout(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(output))
+}
+
+// sortLayerSizes sorts the layers by decreasing compressed size.
+func sortLayerSizes(layers []*LayerSize) {
+	slices.SortFunc(layers, func(a, b *LayerSize) int {
+		if a.CompressedSize != b.CompressedSize {
+			return b.CompressedSize - a.CompressedSize
+		}
+		return strings.Compare(a.Digest, b.Digest)
+	})
+}
+
+func writeLayerSizes(sb *strings.Builder, layers []*LayerSize) {
+	fmt.Fprintf(sb, "| Layer | Compressed | Uncompressed | Used by |\n|---|---|---|---|\n")
+	for _, layer := range layers {
+		fmt.Fprintf(sb, "| `%s` | %s | %s | %s |\n",
+			layer.Digest, humanSize(layer.CompressedSize), optionalHumanSize(layer.UncompressedSize), strings.Join(layer.UsedBy, "<br>"))
+	}
+	fmt.Fprintf(sb, "\n")
+}
+
+// optionalHumanSize returns a human-readable size, or "-" if the size was not computed.
+func optionalHumanSize(size int) string {
+	if size == 0 {
+		return "-"
+	}
+	return humanSize(size)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+const (
+	// the .local suffix makes crane use plain HTTP for this registry, without requiring --insecure
+	sourceRegistryHost = "crane-source.local"
+	sourceRegistryPort = 5000
+)
+
+// sourceRegistry is an ephemeral registry, used to serve Dagger containers
+// to the crane commands which only work on remote images - such as mutate or append.
+type sourceRegistry struct {
+	crane   *Crane
+	service *dagger.Service
+	// crane container bound to the registry
+	ctr *dagger.Container
+}
+
+// startSourceRegistry starts an ephemeral in-memory registry, and binds it to the given crane container.
+// The registry must be stopped once the crane commands using it are done.
+func (c *Crane) startSourceRegistry(ctx context.Context, ctr *dagger.Container) (*sourceRegistry, error) {
+	if ctr == nil {
+		var err error
+		if ctr, err = c.Container(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	service, err := dag.Container().From(baseCraneImage).
+		// a new registry for each call: the execs bound to a previous (stopped) registry must not be cached
+		WithEnvVariable("CRANE_SOURCE_REGISTRY", time.Now().Format(time.RFC3339Nano)).
+		WithExposedPort(sourceRegistryPort).
+		AsService(dagger.ContainerAsServiceOpts{
+			Args:          []string{"registry", "serve", "--address", ":" + strconv.Itoa(sourceRegistryPort)},
+			UseEntrypoint: true,
+		}).
+		Start(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start source registry: %w", err)
+	}
+
+	return &sourceRegistry{
+		crane:   c,
+		service: service,
+		ctr:     ctr.WithServiceBinding(sourceRegistryHost, service),
+	}, nil
+}
+
+// push pushes a container to the registry, and returns its reference.
+func (r *sourceRegistry) push(ctx context.Context, name string, container *dagger.Container) (string, error) {
+	image := sourceRegistryHost + ":" + strconv.Itoa(sourceRegistryPort) + "/" + name + ":" + defaultTag
+	if _, err := r.crane.WithPlatform("").PushTarball(ctx, container.AsTarball(), image, r.ctr); err != nil {
+		return "", fmt.Errorf("failed to push container to source registry: %w", err)
+	}
+	return image, nil
+}
+
+// stop stops the registry. Errors are ignored: the registry is stopped anyway at the end of the session.
+func (r *sourceRegistry) stop(ctx context.Context) {
+	_, _ = r.service.Stop(ctx)
+}
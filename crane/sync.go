@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+	"golang.org/x/sync/errgroup"
+)
+
+// SyncReport is the result of a registry synchronization.
+type SyncReport struct {
+	// destination of the synchronization
+	Destination string
+	// images copied to the destination - or that would be copied in dry-run mode
+	Copied []*SyncItem
+	// images skipped because the destination already has the same digest
+	Skipped []*SyncItem
+	// images that could not be synchronized
+	Failed []*SyncItem
+}
+
+// SyncItem is a single image of a registry synchronization.
+type SyncItem struct {
+	// source image reference
+	Source string
+	// destination image reference
+	Destination string
+	// digest of the source image
+	Digest string
+	// error message - only for failed images
+	Error string
+}
+
+// Json returns the JSON representation of the report.
+func (r *SyncReport) Json() (string, error) { //nolint:stylecheck // we want to name it "json"
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal sync report: %w", err)
+	}
+	return string(data), nil
+}
+
+// Summary returns a one-line summary of the report.
+func (r *SyncReport) Summary() string {
+	return fmt.Sprintf("%d copied, %d skipped, %d failed", len(r.Copied), len(r.Skipped), len(r.Failed))
+}
+
+// Sync mirrors the tags of the source repositories into a destination registry.
+// Each source repository is mirrored under the destination, without its registry:
+// cgr.dev/chainguard/crane is mirrored as <destination>/chainguard/crane.
+// Only the tags whose digest differ between the source and the destination are copied.
+// Failures do not stop the synchronization: they are reported in the result,
+// including the source repositories whose tags could not be listed.
+func (c *Crane) Sync(
+	ctx context.Context,
+	// source repositories to mirror
+	// example: cgr.dev/chainguard/crane
+	sources []string,
+	// destination registry, optionally with a path prefix
+	// example: mirror.example.com/upstream
+	destination string,
+	// only mirror the tags matching this regular expression
+	// +optional
+	pattern string,
+	// only mirror the tags that are semantic versions matching this constraint
+	// example: ">=1.2 <2"
+	// +optional
+	constraint string,
+	// include pre-release versions when filtering with a constraint
+	// +optional
+	// +default=false
+	includePrereleases bool,
+	// do not copy anything, just report what would be copied
+	// +optional
+	// +default=false
+	dryRun bool,
+	// maximum number of images synchronized concurrently
+	// +optional
+	// +default=4
+	concurrency int,
+	// +optional
+	ctr *dagger.Container,
+) (*SyncReport, error) {
+	var (
+		patternRegexp     *regexp.Regexp
+		versionConstraint *semver.Constraints
+		err               error
+	)
+	if pattern != "" {
+		if patternRegexp, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if constraint != "" {
+		if versionConstraint, err = semver.NewConstraint(constraint); err != nil {
+			return nil, fmt.Errorf("invalid constraint %q: %w", constraint, err)
+		}
+	}
+
+	// mirror whole images, including all their platforms
+	cr := c.WithPlatform("")
+	destination = strings.TrimSuffix(destination, "/")
+
+	var (
+		report = &SyncReport{Destination: destination}
+		items  []*SyncItem
+	)
+	for _, source := range sources {
+		tags, err := cr.Ls(ctx, source, false, true, ctr)
+		if err != nil {
+			report.Failed = append(report.Failed, &SyncItem{
+				Source:      source,
+				Destination: destination + "/" + repositoryPath(source),
+				Error:       fmt.Sprintf("failed to list tags of %s: %s", source, err),
+			})
+			continue
+		}
+
+		for _, tag := range tags {
+			if patternRegexp != nil && !patternRegexp.MatchString(tag) {
+				continue
+			}
+			if versionConstraint != nil {
+				version, err := parseVersion(tag)
+				if err != nil || !matchVersion(version, versionConstraint, includePrereleases) {
+					continue
+				}
+			}
+
+			items = append(items, &SyncItem{
+				Source:      source + ":" + tag,
+				Destination: destination + "/" + repositoryPath(source) + ":" + tag,
+			})
+		}
+	}
+
+	var (
+		mu sync.Mutex
+		eg errgroup.Group
+	)
+	if concurrency > 0 {
+		eg.SetLimit(concurrency)
+	}
+	for _, item := range items {
+		eg.Go(func() error {
+			copied, err := cr.syncImage(ctx, item, dryRun, ctr)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				item.Error = err.Error()
+				report.Failed = append(report.Failed, item)
+			case copied:
+				report.Copied = append(report.Copied, item)
+			default:
+				report.Skipped = append(report.Skipped, item)
+			}
+			return nil
+		})
+	}
+	_ = eg.Wait() // errors are reported in the result
+
+	for _, items := range [][]*SyncItem{report.Copied, report.Skipped, report.Failed} {
+		slices.SortFunc(items, func(a, b *SyncItem) int {
+			return strings.Compare(a.Source, b.Source)
+		})
+	}
+	return report, nil
+}
+
+// syncImage copies a single image if the destination does not have the same digest.
+// Returns true if the image was copied - or would be copied in dry-run mode.
+func (c *Crane) syncImage(ctx context.Context, item *SyncItem, dryRun bool, ctr *dagger.Container) (bool, error) {
+	source, err := c.checkImage(ctx, item.Source, ctr)
+	if err != nil {
+		return false, err
+	}
+	if !source.Exists {
+		return false, fmt.Errorf("source image %s not found", item.Source)
+	}
+	item.Digest = source.Digest
+
+	destination, err := c.checkImage(ctx, item.Destination, ctr)
+	if err != nil {
+		return false, err
+	}
+	if destination.Exists && destination.Digest == source.Digest {
+		return false, nil
+	}
+
+	if dryRun {
+		return true, nil
+	}
+	if _, err := c.Copy(ctx, item.Source, nil, item.Destination, false, nil, false, 0, ctr); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// repositoryPath returns the path of a repository, without its registry.
+func repositoryPath(repository string) string {
+	if registry, path, ok := strings.Cut(repository, "/"); ok && isRegistry(registry) {
+		return path
+	}
+	return repository
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// Tag tags a remote image with a new tag - in the same repository.
+// If the tag already exists, it is moved to the given image.
+// Returns the full reference of the new tag.
+func (c *Crane) Tag(
+	ctx context.Context,
+	// image reference to tag
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// new tag to apply to the image
+	tag string,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	if _, err := c.Run(ctx, []string{"tag", image, tag}, ctr); err != nil {
+		return "", fmt.Errorf("failed to run crane tag: %w", err)
+	}
+
+	return repositoryOf(image) + ":" + tag, nil
+}
+
+// Delete deletes a remote image.
+// Note that most registries delete the manifest referenced by the tag,
+// and thus all the tags pointing to the same digest.
+func (c *Crane) Delete(
+	ctx context.Context,
+	// image reference to delete
+	// format: <repository>:<tag> or <repository>@<digest>
+	image string,
+	// +optional
+	ctr *dagger.Container,
+) error {
+	if _, err := c.Run(ctx, []string{"delete", image}, ctr); err != nil {
+		return fmt.Errorf("failed to run crane delete: %w", err)
+	}
+	return nil
+}
+
+// PruneReport is the result of a repository pruning.
+type PruneReport struct {
+	// repository pruned
+	Repository string
+	// tags deleted - or that would be deleted in dry-run mode
+	Deleted []*PruneItem
+	// tags matching the filters, but kept because their digest is still referenced by other tags
+	Skipped []*PruneItem
+}
+
+// PruneItem is a single tag of a repository pruning.
+type PruneItem struct {
+	// full reference of the tag
+	Image string
+	// digest of the tag
+	Digest string
+	// tags not matching the filters which reference the same digest - only for skipped tags
+	SharedWith []string
+}
+
+// Json returns the JSON representation of the report.
+func (r *PruneReport) Json() (string, error) { //nolint:stylecheck // we want to name it "json"
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal prune report: %w", err)
+	}
+	return string(data), nil
+}
+
+// Summary returns a one-line summary of the report.
+func (r *PruneReport) Summary() string {
+	return fmt.Sprintf("%d deleted, %d skipped", len(r.Deleted), len(r.Skipped))
+}
+
+// Prune deletes the tags of a repository matching all the given filters.
+// At least one filter is required. Digest tags (e.g., ':sha256-...') are never pruned.
+// Images are deleted by digest, because deleting a tag deletes its manifest on most registries.
+// So a tag is only deleted if all the tags referencing the same digest match the filters:
+// otherwise it is skipped, and its image is kept.
+// Returns the deleted and skipped tags - or the tags that would be deleted in dry-run mode.
+func (c *Crane) Prune(
+	ctx context.Context,
+	// repository to prune
+	repository string,
+	// only prune tags matching this regular expression
+	// example: ^snapshot-.*
+	// +optional
+	pattern string,
+	// only prune tags that are semantic versions matching this constraint
+	// example: "< 1.0.0" or ">= 1.2, < 2"
+	// +optional
+	constraint string,
+	// include pre-release versions (e.g., 0.9.0-SNAPSHOT) when filtering with a constraint
+	// pre-releases are matched against the constraint using their release version,
+	// so 0.9.0-SNAPSHOT is matched as 0.9.0
+	// +optional
+	// +default=false
+	includePrereleases bool,
+	// only prune tags whose image was created before this duration
+	// uses the "created" time of the image config
+	// example: 720h
+	// +optional
+	olderThan string,
+	// do not delete anything, just return the tags that would be deleted
+	// +optional
+	// +default=false
+	dryRun bool,
+	// +optional
+	ctr *dagger.Container,
+) (*PruneReport, error) {
+	if pattern == "" && constraint == "" && olderThan == "" {
+		return nil, fmt.Errorf("at least one filter (pattern, constraint or olderThan) is required")
+	}
+
+	var (
+		patternRegexp     *regexp.Regexp
+		versionConstraint *semver.Constraints
+		maxAge            time.Duration
+		err               error
+	)
+	if pattern != "" {
+		if patternRegexp, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if constraint != "" {
+		if versionConstraint, err = semver.NewConstraint(constraint); err != nil {
+			return nil, fmt.Errorf("invalid constraint %q: %w", constraint, err)
+		}
+	}
+	if olderThan != "" {
+		if maxAge, err = time.ParseDuration(olderThan); err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %w", olderThan, err)
+		}
+	}
+
+	tags, err := c.Ls(ctx, repository, false, true, ctr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	var selected []string
+	for _, tag := range tags {
+		if patternRegexp != nil && !patternRegexp.MatchString(tag) {
+			continue
+		}
+		if versionConstraint != nil {
+			version, err := parseVersion(tag)
+			if err != nil || !matchVersion(version, versionConstraint, includePrereleases) {
+				continue
+			}
+		}
+
+		image := repository + ":" + tag
+		if maxAge > 0 {
+			config, err := c.Config(ctx, image, "", ctr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get config of %s: %w", image, err)
+			}
+			created, err := time.Parse(time.RFC3339, config.Created)
+			if err != nil || time.Since(created) < maxAge {
+				continue
+			}
+		}
+
+		selected = append(selected, image)
+	}
+
+	report := &PruneReport{Repository: repository}
+	if len(selected) == 0 {
+		return report, nil
+	}
+
+	// resolve the digests of all the tags, to find the digests still referenced by the tags to keep
+	images := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		images = append(images, repository+":"+tag)
+	}
+	checks, err := c.CheckImages(ctx, images, 8, ctr)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		digests = make(map[string]string, len(checks))
+		kept    = make(map[string][]string)
+	)
+	for _, check := range checks {
+		digests[check.Image] = check.Digest
+		if check.Digest != "" && !slices.Contains(selected, check.Image) {
+			kept[check.Digest] = append(kept[check.Digest], check.Image)
+		}
+	}
+
+	var toDelete []string
+	for _, image := range selected {
+		digest := digests[image]
+		switch {
+		case digest == "":
+			// deleted since the tags were listed
+			continue
+		case len(kept[digest]) > 0:
+			report.Skipped = append(report.Skipped, &PruneItem{Image: image, Digest: digest, SharedWith: kept[digest]})
+			continue
+		}
+		report.Deleted = append(report.Deleted, &PruneItem{Image: image, Digest: digest})
+		if !slices.Contains(toDelete, digest) {
+			toDelete = append(toDelete, digest)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	for _, digest := range toDelete {
+		if err := c.Delete(ctx, repository+"@"+digest, ctr); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vbehar/daggerverse/crane/internal/dagger"
+)
+
+// WaitFor polls the registry until the given image exists, or until the timeout expires.
+// The interval between 2 attempts is multiplied by the backoff factor after each attempt,
+// up to the max interval.
+// Rate limits and network errors do not stop the polling, nor do unauthorized errors if allowed:
+// the last error is reported if the timeout expires.
+// Returns the digest of the image.
+func (c *Crane) WaitFor(
+	ctx context.Context,
+	// image to wait for
+	// format: <repository>:<tag>, <repository>@<digest> or <repository> for the latest tag
+	image string,
+	// maximum duration to wait for the image
+	// +optional
+	// +default="10m"
+	timeout string,
+	// initial duration between 2 attempts
+	// +optional
+	// +default="5s"
+	interval string,
+	// factor applied to the interval after each attempt
+	// use 1 for a constant interval
+	// +optional
+	// +default=1.5
+	backoffFactor float64,
+	// maximum duration between 2 attempts
+	// +optional
+	// +default="1m"
+	maxInterval string,
+	// keep polling on unauthorized errors,
+	// returned by registries such as GHCR or Docker Hub for a repository that does not exist yet
+	// +optional
+	// +default=false
+	ignoreUnauthorized bool,
+	// +optional
+	ctr *dagger.Container,
+) (string, error) {
+	timeoutDuration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return "", fmt.Errorf("invalid timeout %q: %w", timeout, err)
+	}
+	wait, err := time.ParseDuration(interval)
+	if err != nil {
+		return "", fmt.Errorf("invalid interval %q: %w", interval, err)
+	}
+	maxWait, err := time.ParseDuration(maxInterval)
+	if err != nil {
+		return "", fmt.Errorf("invalid max interval %q: %w", maxInterval, err)
+	}
+	if backoffFactor < 1 {
+		backoffFactor = 1
+	}
+	if ctr == nil {
+		var err error
+		if ctr, err = c.Container(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	var (
+		deadline = time.Now().Add(timeoutDuration)
+		lastErr  error
+	)
+	for attempt := 1; ; attempt++ {
+		// each attempt must bypass the Dagger cache, or it would return the result of the first one
+		check, err := c.checkImage(ctx, image,
+			ctr.WithEnvVariable("CRANE_WAIT_ATTEMPT", time.Now().Format(time.RFC3339Nano)),
+		)
+		var registryErr *RegistryError
+		switch {
+		case err == nil && check.Exists:
+			return check.Digest, nil
+		case err == nil:
+			lastErr = nil
+		case !errors.As(err, &registryErr):
+			return "", err
+		case registryErr.Temporary(), ignoreUnauthorized && registryErr.Kind == RegistryErrorUnauthorized:
+			lastErr = err
+		default:
+			return "", err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if lastErr != nil {
+				return "", fmt.Errorf("timeout after %s waiting for image %s (%d attempts): %w", timeout, image, attempt, lastErr)
+			}
+			return "", fmt.Errorf("timeout after %s waiting for image %s (%d attempts)", timeout, image, attempt)
+		}
+
+		// do not sleep past the deadline, so that a last attempt is made right before it
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(min(wait, remaining)):
+		}
+
+		wait = min(time.Duration(float64(wait)*backoffFactor), maxWait)
+	}
+}